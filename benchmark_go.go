@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -80,7 +81,60 @@ func benchmarkGo(iterations int) []float64 {
 	return times
 }
 
+// benchmarkGoConcurrentRace runs every test case from N goroutines sharing a
+// single MCPDSLCompiler, parsing and compiling (both Compile and
+// CompileConcurrent) concurrently. It exists to be run under the race
+// detector (`go run -race benchmark_go.go race <goroutines> <iterations>`)
+// as a live demonstration that MCPDSLCompiler's statelessness holds up: a
+// clean run with -race is the proof, a data race is a regression.
+func benchmarkGoConcurrentRace(goroutines, iterations int) time.Duration {
+	compiler := NewMCPDSLCompiler()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				for _, tc := range testCases {
+					ParseMCPDSL(tc.dsl)
+
+					lexer := NewMCPDSLLexer(tc.dsl)
+					parser := NewMCPDSLParser(lexer.Tokenize())
+					nodes, _ := parser.Parse()
+					compiler.Compile(nodes)
+					compiler.CompileConcurrent(nodes, goroutines)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return time.Since(start)
+}
+
 func main() {
+	if len(os.Args) >= 2 && os.Args[1] == "race" {
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "Usage: %s race <goroutines> <iterations>\n", os.Args[0])
+			os.Exit(1)
+		}
+		goroutines, err := strconv.Atoi(os.Args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid goroutines: %v\n", err)
+			os.Exit(1)
+		}
+		iterations, err := strconv.Atoi(os.Args[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid iterations: %v\n", err)
+			os.Exit(1)
+		}
+		elapsed := benchmarkGoConcurrentRace(goroutines, iterations)
+		fmt.Printf("%.2f\n", float64(elapsed.Milliseconds()))
+		return
+	}
+
 	if len(os.Args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: %s <iterations>\n", os.Args[0])
 		os.Exit(1)
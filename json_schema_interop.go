@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// CompileJSONSchemaToDSL renders a standard JSON Schema object — as
+// pulled from a live MCP server's tools/list response, or any other
+// external JSON Schema document — as MCP-DSL schema syntax suitable for a
+// tool's `in:`/`out:` block: "type":"string"/"integer"/"number"/"boolean"
+// map to str/int/num/bool, a "required" array becomes a trailing "!",
+// "enum" becomes enum(a|b|c), "minimum"/"maximum" become (lo..hi),
+// "pattern" becomes (/.../), and nested "object"/"array" types recurse —
+// the same grammar decompileSchema already produces for this package's own
+// compiled tools, so importing a third-party schema round-trips through
+// ParseMCPDSL exactly like one written by hand.
+func CompileJSONSchemaToDSL(schema map[string]interface{}) (string, error) {
+	if schema == nil {
+		return "", fmt.Errorf("mcp-dsl: schema is nil")
+	}
+	if _, ok := schema["properties"]; !ok {
+		return "", fmt.Errorf("mcp-dsl: schema has no \"properties\" to render")
+	}
+	decompiler := NewMCPDSLDecompiler()
+	return decompiler.decompileSchema(schema, 0), nil
+}
+
+// ToolInputSchemaAsJSONSchema parses dsl — a `T name { in: {...} }` tool
+// definition — and renders its inputSchema as a standalone JSON Schema
+// document, the inverse of CompileJSONSchemaToDSL: suitable for handing to
+// any generic JSON Schema-consuming tool outside this package.
+func ToolInputSchemaAsJSONSchema(dsl string) (map[string]interface{}, error) {
+	result, err := ParseMCPDSLStrict(dsl)
+	if err != nil {
+		return nil, err
+	}
+
+	tool, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mcp-dsl: expected a single tool definition, got %T", result)
+	}
+
+	inputSchema, ok := tool["inputSchema"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mcp-dsl: tool %q has no inputSchema", tool["name"])
+	}
+
+	jsonSchema := make(map[string]interface{}, len(inputSchema)+1)
+	jsonSchema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	for key, value := range inputSchema {
+		jsonSchema[key] = value
+	}
+	return jsonSchema, nil
+}
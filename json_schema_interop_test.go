@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileJSONSchemaToDSLRendersPrimitivesAndArray(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"status": map[string]interface{}{
+				"type": "string",
+				"enum": []interface{}{"a", "b"},
+			},
+			"age": map[string]interface{}{
+				"type":    "integer",
+				"minimum": float64(0),
+				"maximum": float64(120),
+			},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required": []interface{}{"status"},
+	}
+
+	dsl, err := CompileJSONSchemaToDSL(schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"status: enum(a|b)!", "age: int(0..120)", "tags: [str]"} {
+		if !strings.Contains(dsl, want) {
+			t.Errorf("expected DSL to contain %q, got:\n%s", want, dsl)
+		}
+	}
+}
+
+func TestCompileJSONSchemaToDSLRejectsSchemaWithoutProperties(t *testing.T) {
+	if _, err := CompileJSONSchemaToDSL(map[string]interface{}{"type": "object"}); err == nil {
+		t.Fatal("expected an error for a schema without properties")
+	}
+}
+
+func TestToolInputSchemaAsJSONSchemaRoundTrips(t *testing.T) {
+	dsl := `T analyze_code {
+		in: {
+			code: str!
+			language: str!
+		}
+	}`
+
+	schema, err := ToolInputSchemaAsJSONSchema(dsl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if schema["$schema"] != "https://json-schema.org/draft/2020-12/schema" {
+		t.Errorf("expected a $schema field, got %v", schema["$schema"])
+	}
+	if schema["type"] != "object" {
+		t.Errorf("expected type object, got %v", schema["type"])
+	}
+	props, ok := schema["properties"].(map[string]interface{})
+	if !ok || len(props) != 2 {
+		t.Fatalf("expected 2 properties, got %v", schema["properties"])
+	}
+
+	rendered, err := CompileJSONSchemaToDSL(schema)
+	if err != nil {
+		t.Fatalf("unexpected error re-rendering schema: %v", err)
+	}
+	if !strings.Contains(rendered, "code: str!") || !strings.Contains(rendered, "language: str!") {
+		t.Errorf("expected round-tripped DSL to keep both required fields, got:\n%s", rendered)
+	}
+}
+
+func TestToolInputSchemaAsJSONSchemaRejectsNonToolInput(t *testing.T) {
+	if _, err := ToolInputSchemaAsJSONSchema(`Type Address { city: str! }`); err == nil {
+		t.Fatal("expected an error for a non-tool definition")
+	}
+}
@@ -5,9 +5,11 @@ package main
 
 import (
 	"encoding/json"
-	
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 )
 
@@ -20,6 +22,16 @@ const (
 	TokenNumber
 	TokenIdentifier
 	TokenOperator
+	// TokenExpression holds the raw text of a "$..." JMESPath-style
+	// expression (see mcp_expr.go), with the leading '$' stripped.
+	TokenExpression
+	// TokenPattern holds the raw text of a "/regex/" string-pattern
+	// constraint (see parseSchemaConstraint), with the delimiting '/'s
+	// stripped. Like TokenExpression it has to be captured as raw text
+	// rather than run through the generic identifier/operator tokenizing,
+	// since a regex body is full of characters (\, ^, $, +) that aren't
+	// meaningful DSL tokens.
+	TokenPattern
 )
 
 // Token represents a lexical token
@@ -28,6 +40,14 @@ type Token struct {
 	Value  string
 	Line   int
 	Column int
+	// Offset and Len locate the token's raw source span (byte offset into
+	// the original input, and byte length of that span as written, before
+	// any quote-stripping/escape-processing). They're wider than len(Value)
+	// whenever the source form isn't the decoded value verbatim — a quoted
+	// string, a """ heredoc, a /pattern/ — which is why diagnostics use them
+	// (rather than len(Found)) to underline the real source text.
+	Offset int
+	Len    int
 }
 
 // MCPDSLLexer tokenizes MCP-DSL input
@@ -66,10 +86,57 @@ func (l *MCPDSLLexer) skipWhitespace() {
 	}
 }
 
-// readString reads a string literal
+// unescapeDSLChar decodes the character following a '\' in a DSL string
+// literal, the reverse of escapeDSLString. An unrecognized escape (e.g.
+// "\q") falls back to the literal character, same as before this escape
+// table existed, so old DSL text using '\' to "escape" an otherwise
+// unremarkable character still lexes the same way.
+func unescapeDSLChar(ch byte) byte {
+	switch ch {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	}
+	return ch
+}
+
+// atTripleQuote reports whether a """ heredoc opener/closer starts at
+// position i.
+func (l *MCPDSLLexer) atTripleQuote(i int) bool {
+	return i+2 < len(l.input) && l.input[i] == '"' && l.input[i+1] == '"' && l.input[i+2] == '"'
+}
+
+// readString reads a string literal: either a normal "..." literal with
+// backslash escapes, or a """...""" heredoc, whose content is taken
+// verbatim (no escape processing) up to the next """ — the form
+// escapeDSLString chooses for any string containing a newline, since
+// escaping every embedded newline as "\n" would make multi-line prompt or
+// description text unreadable in the DSL source.
 func (l *MCPDSLLexer) readString() Token {
 	startLine := l.line
 	startCol := l.column
+	startOffset := l.position
+
+	if l.atTripleQuote(l.position) {
+		l.advance()
+		l.advance()
+		l.advance() // skip opening """
+
+		var value strings.Builder
+		for l.position < len(l.input) && !l.atTripleQuote(l.position) {
+			value.WriteByte(l.input[l.position])
+			l.advance()
+		}
+
+		l.advance()
+		l.advance()
+		l.advance() // skip closing """
+		return Token{Type: TokenString, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
+	}
+
 	l.advance() // Skip opening quote
 
 	var value strings.Builder
@@ -77,7 +144,7 @@ func (l *MCPDSLLexer) readString() Token {
 		if l.input[l.position] == '\\' {
 			l.advance()
 			if l.position < len(l.input) {
-				value.WriteByte(l.input[l.position])
+				value.WriteByte(unescapeDSLChar(l.input[l.position]))
 			}
 		} else {
 			value.WriteByte(l.input[l.position])
@@ -86,13 +153,14 @@ func (l *MCPDSLLexer) readString() Token {
 	}
 
 	l.advance() // Skip closing quote
-	return Token{Type: TokenString, Value: value.String(), Line: startLine, Column: startCol}
+	return Token{Type: TokenString, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
 }
 
 // readNumber reads a number literal
 func (l *MCPDSLLexer) readNumber() Token {
 	startLine := l.line
 	startCol := l.column
+	startOffset := l.position
 	var value strings.Builder
 
 	for l.position < len(l.input) && (unicode.IsDigit(rune(l.input[l.position])) || l.input[l.position] == '.' || l.input[l.position] == '-') {
@@ -100,13 +168,86 @@ func (l *MCPDSLLexer) readNumber() Token {
 		l.advance()
 	}
 
-	return Token{Type: TokenNumber, Value: value.String(), Line: startLine, Column: startCol}
+	return Token{Type: TokenNumber, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
+}
+
+// readExpression reads a "$..." value expression: the raw JMESPath-style
+// text following '$', honoring nested [], {} and backtick-quoted literals
+// so a top-level ',', '}'/']', whitespace, or newline that belongs to the
+// *enclosing* DSL block/array isn't swallowed into the expression text.
+// The actual expression grammar is parsed separately by ParseExpr once the
+// main parser has this raw text in hand (see mcp_expr.go).
+func (l *MCPDSLLexer) readExpression() Token {
+	startLine := l.line
+	startCol := l.column
+	startOffset := l.position
+	l.advance() // skip '$'
+
+	var value strings.Builder
+	depth := 0
+	for l.position < len(l.input) {
+		ch := l.input[l.position]
+		if ch == '`' {
+			value.WriteByte(ch)
+			l.advance()
+			for l.position < len(l.input) && l.input[l.position] != '`' {
+				value.WriteByte(l.input[l.position])
+				l.advance()
+			}
+			if l.position < len(l.input) {
+				value.WriteByte(l.input[l.position])
+				l.advance()
+			}
+			continue
+		}
+		if ch == '[' || ch == '{' {
+			depth++
+		} else if ch == ']' || ch == '}' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		} else if depth == 0 && (ch == ',' || unicode.IsSpace(rune(ch))) {
+			break
+		}
+		value.WriteByte(ch)
+		l.advance()
+	}
+
+	return Token{Type: TokenExpression, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
+}
+
+// readPattern reads a "/regex/" string-pattern constraint, having already
+// confirmed the opening '/'. A backslash escapes the following character
+// (most importantly '/' itself) but, unlike readString, the backslash is
+// kept in the output rather than stripped: regex escapes like \d or \. are
+// only meaningful to the downstream "pattern" consumer with the backslash
+// still attached.
+func (l *MCPDSLLexer) readPattern() Token {
+	startLine := l.line
+	startCol := l.column
+	startOffset := l.position
+	l.advance() // skip opening '/'
+
+	var value strings.Builder
+	for l.position < len(l.input) && l.input[l.position] != '/' {
+		if l.input[l.position] == '\\' && l.position+1 < len(l.input) {
+			value.WriteByte(l.input[l.position])
+			l.advance()
+		}
+		value.WriteByte(l.input[l.position])
+		l.advance()
+	}
+
+	l.advance() // skip closing '/'
+	return Token{Type: TokenPattern, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
 }
 
 // readIdentifier reads an identifier or keyword
 func (l *MCPDSLLexer) readIdentifier() Token {
 	startLine := l.line
 	startCol := l.column
+	startOffset := l.position
 	var value strings.Builder
 
 	for l.position < len(l.input) {
@@ -123,7 +264,7 @@ func (l *MCPDSLLexer) readIdentifier() Token {
 		}
 	}
 
-	return Token{Type: TokenIdentifier, Value: value.String(), Line: startLine, Column: startCol}
+	return Token{Type: TokenIdentifier, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.position - startOffset}
 }
 
 // Tokenize converts input string to tokens
@@ -138,18 +279,29 @@ func (l *MCPDSLLexer) Tokenize() []Token {
 
 		char := l.input[l.position]
 
-		// Operators and symbols
-		if strings.ContainsRune("><!x#@?:=|&-", rune(char)) {
+		if char == '$' {
+			// Expression values ($#1.result.url, $[0, 1]) — read raw text only
+			// here; ParseExpr parses it once the main parser requests it.
+			tokens = append(tokens, l.readExpression())
+		} else if strings.ContainsRune("><!x#@?:=|&-", rune(char)) {
 			tokens = append(tokens, Token{
 				Type:   TokenOperator,
 				Value:  string(char),
 				Line:   l.line,
 				Column: l.column,
+				Offset: l.position,
+				Len:    1,
 			})
 			l.advance()
 		} else if char == '"' {
 			// String literals
 			tokens = append(tokens, l.readString())
+		} else if char == '/' {
+			// A str(/pattern/) constraint's regex body. '/' otherwise only
+			// ever appears mid-identifier (tools/call, file:///...), which
+			// readIdentifier already consumes directly, so a '/' reaching
+			// here is always the start of a fresh pattern token.
+			tokens = append(tokens, l.readPattern())
 		} else if unicode.IsDigit(rune(char)) || (char == '-' && l.position+1 < len(l.input) && unicode.IsDigit(rune(l.input[l.position+1]))) {
 			// Numbers
 			tokens = append(tokens, l.readNumber())
@@ -163,6 +315,8 @@ func (l *MCPDSLLexer) Tokenize() []Token {
 				Value:  string(char),
 				Line:   l.line,
 				Column: l.column,
+				Offset: l.position,
+				Len:    1,
 			})
 			l.advance()
 		} else {
@@ -186,6 +340,29 @@ const (
 	ASTPrompt
 	ASTBlock
 	ASTValue
+	// ASTType is a standalone, named type declaration ("Type Name { ... }")
+	// that can be referenced by name from an "in:" block and compiles to a
+	// JSON Schema $ref instead of a JSON-RPC message of its own.
+	ASTType
+	// ASTEnum is a union-of-literals type, e.g. str|"a"|"b"|"c".
+	ASTEnum
+	// ASTExpr is a "$..." JMESPath-style expression value (see mcp_expr.go)
+	// that references and transforms data from a prior message, e.g.
+	// $#1.result.items[?score > `0.8`].url.
+	ASTExpr
+	// ASTSchema is a typed schema field declared inside an "in:"/"out:"
+	// block via parseSchema: a primitive (with an optional range/pattern
+	// constraint), an array ([str]), an enum(a|b|c), a "&Name" ref to a
+	// reusable Type/Tool schema, or a union of any of those (str|int). A
+	// nested inline object is still an ASTBlock whose BlockFields are
+	// themselves ASTSchema nodes, so compileSchema's existing recursion
+	// over BlockFields keeps working unchanged for nesting.
+	ASTSchema
+	// ASTBatch is a "[[ ... ]]" block of top-level messages that compiles
+	// to a single JSON array value (a JSON-RPC 2.0 batch frame) instead of
+	// each message becoming its own independent top-level result the way
+	// writing the same statements unbracketed would.
+	ASTBatch
 )
 
 // ASTNode represents a node in the abstract syntax tree
@@ -219,12 +396,114 @@ type ASTNode struct {
 
 	// Value fields
 	Val interface{}
+
+	// Schema-field metadata: Required marks a nested object type declared
+	// with a trailing '!' (e.g. "addr: { ... }!"); Annotations holds any
+	// "@key: value" constraints (e.g. @min, @max, @pattern, @format) that
+	// preceded this field within its enclosing block.
+	Required    bool
+	Annotations map[string]*ASTNode
+
+	// Enum fields (ASTEnum): Val holds the base type string (e.g. "str"),
+	// EnumValues holds the literal alternatives (e.g. ["a", "b", "c"]).
+	EnumValues []interface{}
+
+	// Expr fields (ASTExpr): Val holds the parsed *Expr tree, ExprSource
+	// holds the original raw text (used verbatim for the "$ref" placeholder
+	// emitted when no MessageContext is supplied at compile time).
+	ExprSource string
+
+	// Schema fields (ASTSchema): Val holds the bare primitive type name
+	// ("str", "int", "num", "bool") for a leaf type; Required/Nullable hold
+	// its trailing '!'/'?'. SchemaMin/SchemaMax hold an "(lo..hi)" numeric
+	// range, SchemaPattern an "(/regex/)" string pattern. SchemaEnumWords
+	// holds enum(a|b|c)'s bare alternatives. SchemaRef holds the type name
+	// from a "&Name" reference. SchemaItems holds an array type's element
+	// schema. SchemaUnion holds a "str|int"-style union's member schemas,
+	// in which case Val/SchemaRef/etc. on this node itself are unused.
+	Nullable        bool
+	SchemaMin       *float64
+	SchemaMax       *float64
+	SchemaPattern   string
+	SchemaEnumWords []string
+	SchemaRef       string
+	SchemaItems     *ASTNode
+	SchemaUnion     []*ASTNode
+
+	// Batch fields (ASTBatch): BatchMessages holds the enclosed top-level
+	// messages, in source order.
+	BatchMessages []*ASTNode
+}
+
+// Severity distinguishes a Diagnostic the parser recovered from (and kept
+// parsing past) from one where recovery gave up because the input simply
+// ran out, e.g. a block or array still open at EOF. Strict callers can use
+// it to decide whether "no more input" is worth reporting differently from
+// a malformed statement in the middle of the document.
+type Severity int
+
+const (
+	// SeverityError is a malformed construct the parser resynchronized
+	// past; parsing continued and may have produced further nodes.
+	SeverityError Severity = iota
+	// SeverityFatal is recorded when recovery reached end of input before
+	// finding a place to resynchronize, so nothing after it could be
+	// parsed.
+	SeverityFatal
+)
+
+// Diagnostic describes a single malformed construct encountered while
+// parsing, with enough location and context to report actionable feedback.
+type Diagnostic struct {
+	Severity Severity
+	Line     int
+	Column   int
+	Message  string
+	Expected string
+	Found    string
+	// Code is a short, stable machine-readable category for this
+	// diagnostic ("unexpected-token" or "unexpected-eof"), for tooling
+	// that wants to filter/group diagnostics without parsing Message.
+	Code string
+	// Hint is a short actionable suggestion derived from Expected, for
+	// display alongside Message (see FormatDiagnostic).
+	Hint string
+	// Offset and Len give the diagnostic's byte span in the original
+	// source (Offset from Token.Offset, Len from Token.Len), the form an
+	// LSP diagnostic or text-editor decoration needs — Line/Column alone
+	// can't be mapped back to a source range without re-lexing. Len is 0
+	// at end of input, where there's no token to underline.
+	Offset int
+	Len    int
+}
+
+// topLevelSigils are the tokens that start a new message; the parser
+// resynchronizes on these after a failure so one bad statement doesn't
+// abort the rest of the document.
+var topLevelSigils = map[string]bool{
+	">": true, "<": true, "!": true, "x": true, "T": true, "R": true, "P": true, "Type": true, "[": true,
 }
 
 // MCPDSLParser parses tokens into an AST
 type MCPDSLParser struct {
 	tokens   []Token
 	position int
+	errors   []Diagnostic
+
+	// fill, when set, pulls one more token on demand once position reaches
+	// the end of tokens, instead of treating that as end of input. This is
+	// how StreamingParser parses off a pull-based lexer one message at a
+	// time without ever materializing the full token slice; it's nil (and
+	// unused) for the ordinary fully-buffered Parse() path.
+	fill func() (*Token, error)
+	// fillErr records the first error fill returned, so a caller parsing
+	// incrementally can tell a genuine end of input (io.EOF) apart from an
+	// underlying read failure once the in-flight message is done.
+	fillErr error
+	// lastEnd is the byte offset just past the last token consume()
+	// returned, used as the Offset for a diagnostic raised at end of
+	// input, where there's no current token to read a position from.
+	lastEnd int
 }
 
 // NewMCPDSLParser creates a new parser
@@ -235,36 +514,276 @@ func NewMCPDSLParser(tokens []Token) *MCPDSLParser {
 	}
 }
 
+// TokenSource is a pull-based source of tokens: each Next call returns the
+// next token, or (nil, io.EOF) once exhausted. StreamingLexer implements
+// it; the batch lexer doesn't need to, since NewMCPDSLParser already takes
+// its tokens as a fully materialized slice rather than pulling them.
+type TokenSource interface {
+	Next() (*Token, error)
+}
+
+// NewMCPDSLParserFromSource creates a parser that pulls tokens one at a
+// time from src instead of working off a preloaded slice. This is how
+// NewStreamingParser keeps the streaming path from ever buffering more
+// than one top-level message worth of tokens at once.
+func NewMCPDSLParserFromSource(src TokenSource) *MCPDSLParser {
+	p := NewMCPDSLParser(nil)
+	p.fill = src.Next
+	return p
+}
+
+// errorf records a recoverable diagnostic at the current (not yet consumed)
+// token's location. Call sites that already consumed the offending token
+// before detecting the problem (e.g. checking idToken.Type after idToken :=
+// p.consume()) must use errorfAt instead, or the location ends up pointing
+// at whatever token follows the one actually named in the message.
+func (p *MCPDSLParser) errorf(expected, found, format string, args ...interface{}) {
+	p.diagnosef(SeverityError, nil, expected, found, format, args...)
+}
+
+// errorfAt records a recoverable diagnostic at at's location, for a call
+// site that has already consumed the offending token (see errorf).
+func (p *MCPDSLParser) errorfAt(at *Token, expected, found, format string, args ...interface{}) {
+	p.diagnosef(SeverityError, at, expected, found, format, args...)
+}
+
+// fatalf records a diagnostic for a construct recovery couldn't resync
+// past because input ran out first (e.g. an unterminated block or array).
+func (p *MCPDSLParser) fatalf(expected, found, format string, args ...interface{}) {
+	p.diagnosef(SeverityFatal, nil, expected, found, format, args...)
+}
+
+// diagnosef locates the diagnostic at at's position if given, or at the
+// current (not yet consumed) token otherwise; at end of input (both nil),
+// it falls back to p.lastEnd, the offset just past the last consumed token.
+func (p *MCPDSLParser) diagnosef(sev Severity, at *Token, expected, found, format string, args ...interface{}) {
+	line, column := 0, 0
+	offset, length := p.lastEnd, 0
+	tok := at
+	if tok == nil {
+		tok = p.peek()
+	}
+	if tok != nil {
+		line, column = tok.Line, tok.Column
+		offset, length = tok.Offset, tok.Len
+	}
+	p.errors = append(p.errors, Diagnostic{
+		Severity: sev,
+		Line:     line,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+		Expected: expected,
+		Found:    found,
+		Code:     diagnosticCode(found),
+		Hint:     "expected " + expected,
+		Offset:   offset,
+		Len:      length,
+	})
+}
+
+// diagnosticCode buckets a diagnostic by whether it was found at end of
+// input (an unterminated construct) or at some other, present token (a
+// malformed one), so tooling can filter on a stable category instead of
+// matching against Message text.
+func diagnosticCode(found string) string {
+	if found == "end of input" {
+		return "unexpected-eof"
+	}
+	return "unexpected-token"
+}
+
+// FormatDiagnostic renders d as a caret-underlined source snippet in the
+// style of Go's own compiler errors, e.g.:
+//
+//	3:10: expected ':' after field key "code"
+//	    code str
+//	         ^~~
+//
+// so editors and CI tooling can surface a DSL problem inline instead of
+// just a bare line/column pair.
+func FormatDiagnostic(src string, d Diagnostic) string {
+	header := fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+
+	lines := strings.Split(src, "\n")
+	lineIdx := d.Line - 1
+	if lineIdx < 0 || lineIdx >= len(lines) {
+		return header
+	}
+	srcLine := lines[lineIdx]
+
+	col := d.Column - 1
+	if col < 0 {
+		col = 0
+	} else if col > len(srcLine) {
+		col = len(srcLine)
+	}
+
+	caretLen := d.Len
+	if caretLen == 0 || col+caretLen > len(srcLine) {
+		caretLen = 1
+	}
+
+	caret := strings.Repeat(" ", col) + "^" + strings.Repeat("~", caretLen-1)
+	return header + "\n" + srcLine + "\n" + caret
+}
+
+// tokenDesc renders a token (or its absence) for use in an error message.
+func tokenDesc(tok *Token) string {
+	if tok == nil {
+		return "end of input"
+	}
+	return tok.Value
+}
+
+// synchronize discards tokens until the next top-level message sigil so
+// parsing can continue after a malformed statement. It tracks brace/bracket
+// depth while scanning so a sigil-shaped token nested inside a block or
+// array (e.g. a field literally named "T") isn't mistaken for the start of
+// the next message.
+func (p *MCPDSLParser) synchronize() {
+	depth := 0
+	p.advancePastToken(&depth)
+	for p.peek() != nil {
+		if depth == 0 && topLevelSigils[p.peek().Value] {
+			return
+		}
+		p.advancePastToken(&depth)
+	}
+}
+
+// advancePastToken consumes the current token, adjusting depth for any
+// brace/bracket it opens or closes, for use by depth-aware recovery loops.
+func (p *MCPDSLParser) advancePastToken(depth *int) {
+	tok := p.consume()
+	if tok == nil {
+		return
+	}
+	switch tok.Value {
+	case "{", "[":
+		*depth++
+	case "}", "]":
+		if *depth > 0 {
+			*depth--
+		}
+	}
+}
+
+// tryFill pulls one more token via p.fill when the buffered tokens are
+// exhausted. A no-op once fill is unset or has already errored.
+func (p *MCPDSLParser) tryFill() {
+	if p.fill == nil || p.fillErr != nil || p.position < len(p.tokens) {
+		return
+	}
+	tok, err := p.fill()
+	if err != nil {
+		p.fillErr = err
+		return
+	}
+	if tok != nil {
+		p.tokens = append(p.tokens, *tok)
+	}
+}
+
 // peek returns the current token without consuming it
 func (p *MCPDSLParser) peek() *Token {
+	p.tryFill()
 	if p.position < len(p.tokens) {
 		return &p.tokens[p.position]
 	}
 	return nil
 }
 
+// peekAt returns the token n positions ahead of the current one (0 is the
+// same token peek() returns) without consuming anything, pulling more input
+// via fill as needed. Used by parseSchema to look past a '|' to decide
+// between the old literal-enum grammar and the type-union grammar.
+func (p *MCPDSLParser) peekAt(n int) *Token {
+	for p.position+n >= len(p.tokens) {
+		if p.fill == nil || p.fillErr != nil {
+			break
+		}
+		tok, err := p.fill()
+		if err != nil {
+			p.fillErr = err
+			break
+		}
+		if tok == nil {
+			break
+		}
+		p.tokens = append(p.tokens, *tok)
+	}
+	if p.position+n < len(p.tokens) {
+		return &p.tokens[p.position+n]
+	}
+	return nil
+}
+
 // consume consumes and returns the current token
 func (p *MCPDSLParser) consume() *Token {
+	p.tryFill()
 	if p.position < len(p.tokens) {
 		token := &p.tokens[p.position]
 		p.position++
+		p.lastEnd = token.Offset + token.Len
 		return token
 	}
 	return nil
 }
 
-// Parse parses tokens into an AST
-func (p *MCPDSLParser) Parse() []*ASTNode {
+// consumeMinus consumes a standalone '-' operator token if that's what comes
+// next, reporting whether it did. The lexer never folds '-' into the number
+// that follows it (see parseValue's TokenOperator case), so every "#id"/error
+// -code parse site that wants to support a negative literal has to check for
+// and consume this token itself before reading the number.
+func (p *MCPDSLParser) consumeMinus() bool {
+	if p.peek() != nil && p.peek().Value == "-" {
+		p.consume()
+		return true
+	}
+	return false
+}
+
+// isValueStartToken reports whether tok can begin a params/result value in
+// the position right after a message's "#id" (or, for a notification, its
+// method name): the usual "{...}" object, a "[...]" array for positional
+// params or an array result, or a bare scalar. It deliberately excludes a
+// bare TokenIdentifier other than "true"/"false" — otherwise a request or
+// notification with no params/result at all would swallow the next
+// top-level message's own sigil ("T", "R", "P", "Type") as if it were this
+// message's value instead of letting parseMessage dispatch on it.
+func isValueStartToken(tok *Token) bool {
+	switch tok.Type {
+	case TokenString, TokenNumber, TokenExpression:
+		return true
+	case TokenSymbol:
+		return tok.Value == "{" || tok.Value == "["
+	case TokenOperator:
+		return tok.Value == "-"
+	case TokenIdentifier:
+		return tok.Value == "true" || tok.Value == "false"
+	}
+	return false
+}
+
+// Parse parses tokens into an AST, collecting a Diagnostic for every
+// malformed message instead of stopping at the first one.
+func (p *MCPDSLParser) Parse() ([]*ASTNode, []Diagnostic) {
 	var nodes []*ASTNode
 
 	for p.peek() != nil {
+		startPos := p.position
 		node := p.parseMessage()
 		if node != nil {
 			nodes = append(nodes, node)
 		}
+		// A parseX helper that fails without consuming anything would spin
+		// forever; make sure we always make progress.
+		if p.position == startPos {
+			p.consume()
+		}
 	}
 
-	return nodes
+	return nodes, p.errors
 }
 
 // parseMessage parses a single message
@@ -289,18 +808,60 @@ func (p *MCPDSLParser) parseMessage() *ASTNode {
 		return p.parseResourceDefinition()
 	case "P":
 		return p.parsePromptDefinition()
+	case "Type":
+		return p.parseTypeDefinition()
+	case "[":
+		if next := p.peekAt(1); next != nil && next.Value == "[" {
+			return p.parseBatch()
+		}
+		p.errorf(">, <, !, x, T, R, or P", token.Value, "unexpected token %q at start of message", token.Value)
+		p.synchronize()
+		return nil
 	default:
-		p.consume() // Skip unknown token
+		p.errorf(">, <, !, x, T, R, or P", token.Value, "unexpected token %q at start of message", token.Value)
+		p.synchronize()
 		return nil
 	}
 }
 
+// parseBatch parses a "[[ ... ]]" block: zero or more top-level messages
+// that compile into a single JSON array value (a JSON-RPC 2.0 batch frame)
+// rather than each becoming its own independent result.
+func (p *MCPDSLParser) parseBatch() *ASTNode {
+	p.consume() // consume first '['
+	p.consume() // consume second '['
+
+	var messages []*ASTNode
+	for {
+		if p.peek() == nil {
+			p.fatalf("]]", "end of input", "expected ']]' to close batch")
+			break
+		}
+		if p.peek().Value == "]" && p.peekAt(1) != nil && p.peekAt(1).Value == "]" {
+			p.consume()
+			p.consume()
+			break
+		}
+		startPos := p.position
+		node := p.parseMessage()
+		if node != nil {
+			messages = append(messages, node)
+		}
+		if p.position == startPos {
+			p.consume()
+		}
+	}
+
+	return &ASTNode{Kind: ASTBatch, BatchMessages: messages}
+}
+
 // parseRequest parses a request message
 func (p *MCPDSLParser) parseRequest() *ASTNode {
 	p.consume() // consume '>'
 
 	methodToken := p.consume()
 	if methodToken == nil {
+		p.errorf("method name", "end of input", "expected a method name after '>'")
 		return nil
 	}
 
@@ -312,16 +873,21 @@ func (p *MCPDSLParser) parseRequest() *ASTNode {
 	// Check for #id
 	if p.peek() != nil && p.peek().Value == "#" {
 		p.consume() // consume '#'
+		negative := p.consumeMinus()
 		idToken := p.consume()
 		if idToken != nil && idToken.Type == TokenNumber {
 			id, _ := strconv.Atoi(idToken.Value)
+			if negative {
+				id = -id
+			}
 			node.ReqID = &id
 		}
 	}
 
-	// Check for params block
-	if p.peek() != nil && p.peek().Value == "{" {
-		node.ReqParams = p.parseBlock()
+	// Check for params: the usual "{...}" object, or (JSON-RPC also allows
+	// positional params) an array/scalar value instead.
+	if tok := p.peek(); tok != nil && isValueStartToken(tok) {
+		node.ReqParams = p.parseValue()
 	}
 
 	return node
@@ -334,25 +900,32 @@ func (p *MCPDSLParser) parseResponse() *ASTNode {
 	// Expect #id
 	if p.peek() != nil && p.peek().Value == "#" {
 		p.consume() // consume '#'
+		negative := p.consumeMinus()
 		idToken := p.consume()
 		if idToken == nil || idToken.Type != TokenNumber {
+			p.errorfAt(idToken, "numeric id", tokenDesc(idToken), "expected a numeric id after '#' in response")
 			return nil
 		}
 
 		id, _ := strconv.Atoi(idToken.Value)
+		if negative {
+			id = -id
+		}
 		node := &ASTNode{
 			Kind:   ASTResponse,
 			RespID: id,
 		}
 
-		// Check for result block
-		if p.peek() != nil && p.peek().Value == "{" {
-			node.RespResult = p.parseBlock()
+		// Check for a result: an object block, or (a JSON-RPC result can be
+		// any JSON value) an array/scalar value instead.
+		if tok := p.peek(); tok != nil && isValueStartToken(tok) {
+			node.RespResult = p.parseValue()
 		}
 
 		return node
 	}
 
+	p.errorf("#", tokenDesc(p.peek()), "expected '#' after '<'")
 	return nil
 }
 
@@ -362,6 +935,7 @@ func (p *MCPDSLParser) parseNotification() *ASTNode {
 
 	methodToken := p.consume()
 	if methodToken == nil {
+		p.errorf("method name", "end of input", "expected a method name after '!'")
 		return nil
 	}
 
@@ -370,9 +944,10 @@ func (p *MCPDSLParser) parseNotification() *ASTNode {
 		NotifMethod: methodToken.Value,
 	}
 
-	// Check for params block
-	if p.peek() != nil && p.peek().Value == "{" {
-		node.NotifParams = p.parseBlock()
+	// Check for params: the usual "{...}" object, or (JSON-RPC also allows
+	// positional params) an array/scalar value instead.
+	if tok := p.peek(); tok != nil && isValueStartToken(tok) {
+		node.NotifParams = p.parseValue()
 	}
 
 	return node
@@ -385,26 +960,34 @@ func (p *MCPDSLParser) parseError() *ASTNode {
 	// Expect #id
 	if p.peek() != nil && p.peek().Value == "#" {
 		p.consume() // consume '#'
+		idNegative := p.consumeMinus()
 		idToken := p.consume()
 		if idToken == nil || idToken.Type != TokenNumber {
+			p.errorfAt(idToken, "numeric id", tokenDesc(idToken), "expected a numeric id after '#' in error message")
 			return nil
 		}
 
 		id, _ := strconv.Atoi(idToken.Value)
+		if idNegative {
+			id = -id
+		}
 
 		// Check for negative error code
 		code := 0
-		if p.peek() != nil && p.peek().Value == "-" {
-			p.consume() // consume '-'
+		if p.consumeMinus() {
 			codeToken := p.consume()
 			if codeToken != nil && codeToken.Type == TokenNumber {
 				codeVal, _ := strconv.Atoi(codeToken.Value)
 				code = -codeVal
+			} else {
+				p.errorfAt(codeToken, "numeric error code", tokenDesc(codeToken), "expected a numeric error code after '-'")
+				return nil
 			}
 		} else {
 			// Positive error code
 			codeToken := p.consume()
 			if codeToken == nil || codeToken.Type != TokenNumber {
+				p.errorfAt(codeToken, "numeric error code", tokenDesc(codeToken), "expected a numeric error code")
 				return nil
 			}
 			code, _ = strconv.Atoi(codeToken.Value)
@@ -430,6 +1013,7 @@ func (p *MCPDSLParser) parseError() *ASTNode {
 		}
 	}
 
+	p.errorf("#", tokenDesc(p.peek()), "expected '#' after 'x'")
 	return nil
 }
 
@@ -439,6 +1023,7 @@ func (p *MCPDSLParser) parseToolDefinition() *ASTNode {
 
 	nameToken := p.consume()
 	if nameToken == nil {
+		p.errorf("tool name", "end of input", "expected a tool name after 'T'")
 		return nil
 	}
 
@@ -453,6 +1038,7 @@ func (p *MCPDSLParser) parseToolDefinition() *ASTNode {
 		block := p.parseBlock()
 		if block != nil {
 			node.DefFields = block.BlockFields
+			node.Annotations = block.Annotations
 		}
 	}
 
@@ -465,6 +1051,7 @@ func (p *MCPDSLParser) parseResourceDefinition() *ASTNode {
 
 	nameToken := p.consume()
 	if nameToken == nil {
+		p.errorf("resource name", "end of input", "expected a resource name after 'R'")
 		return nil
 	}
 
@@ -479,6 +1066,7 @@ func (p *MCPDSLParser) parseResourceDefinition() *ASTNode {
 		block := p.parseBlock()
 		if block != nil {
 			node.DefFields = block.BlockFields
+			node.Annotations = block.Annotations
 		}
 	}
 
@@ -491,6 +1079,7 @@ func (p *MCPDSLParser) parsePromptDefinition() *ASTNode {
 
 	nameToken := p.consume()
 	if nameToken == nil {
+		p.errorf("prompt name", "end of input", "expected a prompt name after 'P'")
 		return nil
 	}
 
@@ -505,6 +1094,39 @@ func (p *MCPDSLParser) parsePromptDefinition() *ASTNode {
 		block := p.parseBlock()
 		if block != nil {
 			node.DefFields = block.BlockFields
+			node.Annotations = block.Annotations
+		}
+	}
+
+	return node
+}
+
+// parseTypeDefinition parses a standalone named type declaration
+// ("Type Name { ... }"). It shares the "in:" block grammar and is resolved
+// by name wherever it's referenced, compiling to a JSON Schema $ref.
+func (p *MCPDSLParser) parseTypeDefinition() *ASTNode {
+	p.consume() // consume 'Type'
+
+	nameToken := p.consume()
+	if nameToken == nil {
+		p.errorf("type name", "end of input", "expected a type name after 'Type'")
+		return nil
+	}
+
+	node := &ASTNode{
+		Kind:      ASTType,
+		DefName:   nameToken.Value,
+		DefFields: make(map[string]*ASTNode),
+	}
+
+	if p.peek() != nil && p.peek().Value == "{" {
+		// A Type body shares the same field grammar as an "in:"/"out:"
+		// block (see parseSchema), so the same declaration can be reused
+		// for both a reusable Type and a tool's inline schema.
+		block := p.parseSchemaBlock()
+		if block != nil {
+			node.DefFields = block.BlockFields
+			node.Annotations = block.Annotations
 		}
 	}
 
@@ -520,18 +1142,31 @@ func (p *MCPDSLParser) parseBlock() *ASTNode {
 		BlockFields: make(map[string]*ASTNode),
 	}
 
+	// pendingAnnotations accumulates "@key: value" constraints until the
+	// next real field, which they then attach to (e.g. "@min: 0" followed
+	// by "age: int!" constrains the age field, not the block as a whole).
+	pendingAnnotations := make(map[string]*ASTNode)
+
 	for p.peek() != nil && p.peek().Value != "}" {
-		// Skip annotations
+		// Annotations
 		if p.peek().Value == "@" {
 			p.consume() // consume '@'
 			keyToken := p.consume()
 			if keyToken == nil {
 				break
 			}
+			if keyToken.Type != TokenIdentifier {
+				p.errorfAt(keyToken, "an annotation name", keyToken.Value, "unexpected token %q where an annotation name was expected", keyToken.Value)
+				p.recoverBlockField()
+				continue
+			}
 			// Expect ':'
 			if p.peek() != nil && p.peek().Value == ":" {
 				p.consume() // consume ':'
-				p.parseValue() // consume value
+				pendingAnnotations[keyToken.Value] = p.parseValue()
+			} else {
+				// Bare annotation, e.g. "@readonly"
+				pendingAnnotations[keyToken.Value] = &ASTNode{Kind: ASTValue, Val: true}
 			}
 			continue
 		}
@@ -541,18 +1176,70 @@ func (p *MCPDSLParser) parseBlock() *ASTNode {
 		if keyToken == nil {
 			break
 		}
+		if keyToken.Type != TokenIdentifier {
+			p.errorfAt(keyToken, "a field key", keyToken.Value, "unexpected token %q where a field key was expected", keyToken.Value)
+			p.recoverBlockField()
+			continue
+		}
 
 		// Expect ':'
 		if p.peek() == nil || p.peek().Value != ":" {
-			break
+			p.errorf(":", tokenDesc(p.peek()), "expected ':' after field key %q", keyToken.Value)
+			p.recoverBlockField()
+			continue
 		}
 		p.consume() // consume ':'
 
-		// Parse value
-		value := p.parseValue()
-		if value != nil {
-			node.BlockFields[keyToken.Value] = value
+		// Parse value. "in:"/"out:" always hold a schema block (see
+		// parseSchema), so their fields go through the dedicated schema
+		// grammar instead of the generic value grammar every other field
+		// uses.
+		var value *ASTNode
+		if (keyToken.Value == "in" || keyToken.Value == "out") && p.peek() != nil && p.peek().Value == "{" {
+			value = p.parseSchemaBlock()
+		} else {
+			value = p.parseValue()
+		}
+		if value == nil {
+			p.errorf("a value", tokenDesc(p.peek()), "expected a value for field %q", keyToken.Value)
+			p.recoverBlockField()
+			continue
+		}
+
+		// A nested object can be marked required with a trailing '!', the
+		// same way scalar types are (e.g. "addr: { ... }!").
+		if value.Kind == ASTBlock && p.peek() != nil && p.peek().Value == "!" {
+			p.consume()
+			value.Required = true
+		}
+
+		// Constraint annotations can also trail the field they apply to on
+		// the same line (e.g. "age: int! @min: 0 @max: 130"). A nested
+		// object's own trailing "@" lines (e.g. "in: {...}" followed by a
+		// tool-level "@readonly") aren't a constraint on that object, so
+		// they fall through to pendingAnnotations like any other bare
+		// annotation and attach to whatever comes next instead.
+		if value.Kind != ASTBlock {
+			for p.peek() != nil && p.peek().Value == "@" {
+				p.consume() // consume '@'
+				keyToken := p.consume()
+				if keyToken == nil {
+					break
+				}
+				if p.peek() != nil && p.peek().Value == ":" {
+					p.consume() // consume ':'
+					pendingAnnotations[keyToken.Value] = p.parseValue()
+				} else {
+					pendingAnnotations[keyToken.Value] = &ASTNode{Kind: ASTValue, Val: true}
+				}
+			}
+		}
+
+		if len(pendingAnnotations) > 0 {
+			value.Annotations = pendingAnnotations
+			pendingAnnotations = make(map[string]*ASTNode)
 		}
+		node.BlockFields[keyToken.Value] = value
 
 		// Optional comma
 		if p.peek() != nil && p.peek().Value == "," {
@@ -562,13 +1249,59 @@ func (p *MCPDSLParser) parseBlock() *ASTNode {
 
 	if p.peek() != nil && p.peek().Value == "}" {
 		p.consume() // consume '}'
+	} else {
+		p.fatalf("}", "end of input", "expected '}' to close block")
+	}
+
+	// Annotations with no further field to attach to (e.g. a trailing
+	// "@readonly" right before the closing '}') describe the block itself.
+	if len(pendingAnnotations) > 0 {
+		node.Annotations = pendingAnnotations
 	}
 
 	return node
 }
 
-// parseValue parses a value
+// recoverBlockField skips tokens until the next ',' or the block's closing
+// '}' at the current nesting depth, so one malformed field (an unexpected
+// key token, a missing ':', or a missing value) doesn't take the rest of
+// the block down with it. A ',' is consumed, leaving the loop in parseBlock
+// positioned at the next field; a '}' is left for that loop to consume.
+func (p *MCPDSLParser) recoverBlockField() {
+	depth := 0
+	for p.peek() != nil {
+		tok := p.peek()
+		if depth == 0 {
+			if tok.Value == "," {
+				p.consume()
+				return
+			}
+			if tok.Value == "}" {
+				return
+			}
+		}
+		p.advancePastToken(&depth)
+	}
+}
+
+// parseValue parses a value, including the "|lit|lit..." tail of an enum
+// type declaration (e.g. str|"a"|"b"|"c") following a scalar base value.
 func (p *MCPDSLParser) parseValue() *ASTNode {
+	base := p.parsePrimaryValue()
+	if base == nil {
+		return nil
+	}
+
+	if base.Kind == ASTValue && p.peek() != nil && p.peek().Value == "|" {
+		return p.parseEnumValue(base)
+	}
+
+	return base
+}
+
+// parsePrimaryValue parses a single value without looking for a following
+// enum union.
+func (p *MCPDSLParser) parsePrimaryValue() *ASTNode {
 	token := p.peek()
 	if token == nil {
 		return nil
@@ -597,317 +1330,2613 @@ func (p *MCPDSLParser) parseValue() *ASTNode {
 		} else if token.Value == "[" {
 			return p.parseArray()
 		}
+	case TokenExpression:
+		p.consume()
+		expr, err := ParseExpr(token.Value)
+		if err != nil {
+			p.errorfAt(token, "valid expression", token.Value, "malformed expression: %v", err)
+			return nil
+		}
+		return &ASTNode{Kind: ASTExpr, Val: expr, ExprSource: token.Value}
+	case TokenOperator:
+		// The lexer emits a standalone '-' operator token ahead of a number
+		// token rather than folding them together (it only special-cases the
+		// combined form for error codes), so a negative literal elsewhere —
+		// an array element, a param/result field — has to be reassembled here.
+		if token.Value == "-" {
+			p.consume()
+			numTok := p.peek()
+			if numTok == nil || numTok.Type != TokenNumber {
+				p.errorf("number", tokenDesc(numTok), "expected a number after '-'")
+				return nil
+			}
+			p.consume()
+			num, _ := strconv.ParseFloat(numTok.Value, 64)
+			return &ASTNode{Kind: ASTValue, Val: -num}
+		}
 	}
 
 	return nil
 }
 
+// parseEnumValue parses the "|lit|lit..." tail of an enum type declaration
+// like str|"a"|"b"|"c", given the already-parsed base type node.
+func (p *MCPDSLParser) parseEnumValue(base *ASTNode) *ASTNode {
+	baseType, _ := base.Val.(string)
+	node := &ASTNode{Kind: ASTEnum, Val: baseType}
+
+	for p.peek() != nil && p.peek().Value == "|" {
+		p.consume() // consume '|'
+		lit := p.parsePrimaryValue()
+		if lit == nil {
+			p.errorf("enum literal", "end of input", "expected a literal after '|' in enum type")
+			break
+		}
+		node.EnumValues = append(node.EnumValues, lit.Val)
+	}
+
+	return node
+}
+
 // parseArray parses an array
 func (p *MCPDSLParser) parseArray() *ASTNode {
 	p.consume() // consume '['
 
-	var items []interface{}
+	// Starts non-nil (not "var items []interface{}") so that "[]" round-trips
+	// back to a JSON "[]" rather than "null": compileNode returns this slice
+	// verbatim for an array params/result, and json.Marshal tells a nil slice
+	// and an empty one apart.
+	items := []interface{}{}
+
+	// isClose is checked by Type as well as Value: a string element whose
+	// content happens to be exactly "]" (or ",") must not be mistaken for
+	// the array's closing bracket (or a separator) just because its token
+	// Value matches — only an actual TokenSymbol does.
+	isClose := func(tok *Token) bool { return tok != nil && tok.Type == TokenSymbol && tok.Value == "]" }
+	isComma := func(tok *Token) bool { return tok != nil && tok.Type == TokenSymbol && tok.Value == "," }
 
-	for p.peek() != nil && p.peek().Value != "]" {
+	for p.peek() != nil && !isClose(p.peek()) {
 		value := p.parseValue()
 		if value != nil {
 			items = append(items, value.Val)
 		}
 
 		// Optional comma
-		if p.peek() != nil && p.peek().Value == "," {
+		if isComma(p.peek()) {
 			p.consume()
 		}
 	}
 
-	if p.peek() != nil && p.peek().Value == "]" {
+	if isClose(p.peek()) {
 		p.consume() // consume ']'
+	} else {
+		p.fatalf("]", "end of input", "expected ']' to close array")
 	}
 
 	return &ASTNode{Kind: ASTValue, Val: items}
 }
 
-// MCPDSLCompiler compiles AST to JSON-RPC
-type MCPDSLCompiler struct{}
-
-// NewMCPDSLCompiler creates a new compiler
-func NewMCPDSLCompiler() *MCPDSLCompiler {
-	return &MCPDSLCompiler{}
-}
+// parseSchema parses one "in:"/"out:" field's type expression: a primitive
+// (with an optional constraint), an array ([str]), an enum(a|b|c), a
+// "&Name" ref to a reusable Type/Tool schema, a nested inline object, or a
+// union of any of those (str|int). It's also used recursively for array
+// element types, union members, and the fields of a nested inline object
+// (see parseSchemaBlock).
+func (p *MCPDSLParser) parseSchema() *ASTNode {
+	first := p.parseSchemaAtom()
+	if first == nil {
+		return nil
+	}
+	if p.peek() == nil || p.peek().Value != "|" {
+		return first
+	}
 
-// Compile compiles AST nodes to JSON-RPC
-func (c *MCPDSLCompiler) Compile(nodes []*ASTNode) interface{} {
-	if len(nodes) == 1 {
-		return c.compileNode(nodes[0])
+	// "str|"a"|"b"|"c"" is the older union-of-literal-values grammar,
+	// already handled by parseEnumValue; "str|int" is a union of types.
+	// Both use '|', so which one this is comes down to whether what
+	// follows it is a literal token or a type token.
+	if lookahead := p.peekAt(1); lookahead != nil && (lookahead.Type == TokenString || lookahead.Type == TokenNumber) {
+		baseType, _ := first.Val.(string)
+		if first.Required {
+			baseType += "!"
+		}
+		return p.parseEnumValue(&ASTNode{Kind: ASTValue, Val: baseType})
 	}
 
-	var results []interface{}
-	for _, node := range nodes {
-		results = append(results, c.compileNode(node))
+	union := []*ASTNode{first}
+	for p.peek() != nil && p.peek().Value == "|" {
+		p.consume() // consume '|'
+		next := p.parseSchemaAtom()
+		if next == nil {
+			p.errorf("a type", tokenDesc(p.peek()), "expected a type after '|' in a union")
+			break
+		}
+		union = append(union, next)
 	}
-	return results
+
+	node := &ASTNode{Kind: ASTSchema, SchemaUnion: union}
+	p.parseSchemaSuffix(node)
+	return node
 }
 
-// compileNode compiles a single AST node
-func (c *MCPDSLCompiler) compileNode(node *ASTNode) interface{} {
-	switch node.Kind {
-	case ASTRequest:
-		return c.compileRequest(node)
-	case ASTResponse:
-		return c.compileResponse(node)
-	case ASTNotification:
-		return c.compileNotification(node)
-	case ASTError:
-		return c.compileError(node)
-	case ASTTool:
-		return c.compileTool(node)
+// parseSchemaAtom parses a single schema type without looking for a
+// following union: a primitive (with an optional constraint), an array, an
+// enum(...), a "&Name" ref, or a nested inline object.
+func (p *MCPDSLParser) parseSchemaAtom() *ASTNode {
+	token := p.peek()
+	if token == nil {
+		return nil
+	}
+
+	switch {
+	case token.Type == TokenSymbol && token.Value == "[":
+		p.consume()
+		item := p.parseSchema()
+		if p.peek() != nil && p.peek().Value == "]" {
+			p.consume()
+		} else if p.peek() == nil {
+			p.fatalf("]", "end of input", "expected ']' to close array type")
+		} else {
+			p.errorf("]", p.peek().Value, "expected ']' to close array type")
+		}
+		node := &ASTNode{Kind: ASTSchema, SchemaItems: item}
+		// "[int!]"'s '!' marks the array field itself required, the same
+		// way a bare "int!" marks a scalar field required — it isn't
+		// claiming every element is non-null.
+		if item != nil {
+			node.Required = item.Required
+		}
+		return node
+
+	case token.Type == TokenSymbol && token.Value == "{":
+		block := p.parseSchemaBlock()
+		p.parseSchemaSuffix(block)
+		return block
+
+	case token.Type == TokenOperator && token.Value == "&":
+		p.consume()
+		nameTok := p.consume()
+		if nameTok == nil || nameTok.Type != TokenIdentifier {
+			p.errorfAt(nameTok, "a type name", tokenDesc(nameTok), "expected a type name after '&'")
+			return nil
+		}
+		// A trailing '!' bakes into the identifier token itself (see
+		// MCPDSLLexer.readIdentifier), same as for a bare primitive name.
+		name := nameTok.Value
+		required := strings.HasSuffix(name, "!")
+		name = strings.TrimSuffix(name, "!")
+		node := &ASTNode{Kind: ASTSchema, SchemaRef: name, Required: required}
+		p.parseSchemaSuffix(node)
+		return node
+
+	case token.Type == TokenIdentifier:
+		p.consume()
+		if token.Value == "enum" && p.peek() != nil && p.peek().Value == "(" {
+			p.consume() // consume '('
+			var words []string
+			for p.peek() != nil && p.peek().Value != ")" {
+				word := p.consume()
+				if word != nil && word.Type == TokenIdentifier {
+					words = append(words, word.Value)
+				}
+				if p.peek() != nil && p.peek().Value == "|" {
+					p.consume()
+				}
+			}
+			if p.peek() != nil && p.peek().Value == ")" {
+				p.consume()
+			} else {
+				p.errorf(")", tokenDesc(p.peek()), "expected ')' to close enum(...)")
+			}
+			node := &ASTNode{Kind: ASTSchema, SchemaEnumWords: words}
+			p.parseSchemaSuffix(node)
+			return node
+		}
+
+		raw := token.Value
+		required := strings.HasSuffix(raw, "!")
+		raw = strings.TrimSuffix(raw, "!")
+		node := &ASTNode{Kind: ASTSchema, Val: raw, Required: required}
+
+		if p.peek() != nil && p.peek().Value == "(" {
+			p.consume()
+			p.parseSchemaConstraint(node)
+			if p.peek() != nil && p.peek().Value == ")" {
+				p.consume()
+			} else {
+				p.errorf(")", tokenDesc(p.peek()), "expected ')' to close constraint")
+			}
+		}
+
+		p.parseSchemaSuffix(node)
+		return node
+	}
+
+	return nil
+}
+
+// parseSchemaSuffix consumes a schema atom's trailing '!'/'?' modifiers.
+// Most of the time '!' arrives already glued to the preceding identifier
+// token (see MCPDSLLexer.readIdentifier), but it tokenizes on its own after
+// a ')' or '}' — e.g. "int(0..100)!" or "{ ... }!" — so both forms need
+// accepting here.
+func (p *MCPDSLParser) parseSchemaSuffix(node *ASTNode) {
+	if node == nil {
+		return
+	}
+	for p.peek() != nil {
+		switch p.peek().Value {
+		case "!":
+			p.consume()
+			node.Required = true
+		case "?":
+			p.consume()
+			node.Nullable = true
+		default:
+			return
+		}
+	}
+}
+
+// parseSchemaConstraint parses the contents of a primitive type's "(...)"
+// constraint: a numeric range ("0..100", lexed as one TokenNumber since
+// readNumber consumes '.' greedily) or a string pattern ("/^v\d+$/", lexed
+// as a single TokenPattern by readPattern).
+func (p *MCPDSLParser) parseSchemaConstraint(node *ASTNode) {
+	tok := p.peek()
+	if tok == nil {
+		return
+	}
+
+	if tok.Type == TokenPattern {
+		p.consume()
+		node.SchemaPattern = tok.Value
+		return
+	}
+
+	if tok.Type == TokenNumber {
+		lo, hi, ok := strings.Cut(tok.Value, "..")
+		if !ok {
+			p.errorf("lo..hi", tok.Value, "expected a 'lo..hi' range inside numeric constraint")
+			p.consume()
+			return
+		}
+		p.consume()
+		if loVal, err := strconv.ParseFloat(lo, 64); err == nil {
+			node.SchemaMin = &loVal
+		}
+		if hiVal, err := strconv.ParseFloat(hi, 64); err == nil {
+			node.SchemaMax = &hiVal
+		}
+		return
+	}
+
+	p.errorf("a range or pattern", tokenDesc(tok), "expected a 'lo..hi' range or '/pattern/' inside constraint")
+}
+
+// parseSchemaBlock parses the "{ ... }" body of an "in:"/"out:" field, a
+// Type declaration, or a nested inline object: a set of field-name/schema
+// pairs, each optionally followed by constraint annotations (@min, @max,
+// @pattern, @format). Unlike parseBlock's own trailing-annotation handling,
+// a schema block's annotations always constrain the field they trail —
+// there's no block-level annotation concept in schema context to confuse
+// them with.
+func (p *MCPDSLParser) parseSchemaBlock() *ASTNode {
+	p.consume() // consume '{'
+	node := &ASTNode{Kind: ASTBlock, BlockFields: make(map[string]*ASTNode)}
+
+	for p.peek() != nil && p.peek().Value != "}" {
+		keyToken := p.consume()
+		if keyToken == nil {
+			break
+		}
+		if keyToken.Type != TokenIdentifier {
+			p.errorfAt(keyToken, "a field key", keyToken.Value, "unexpected token %q where a schema field key was expected", keyToken.Value)
+			p.recoverBlockField()
+			continue
+		}
+		if p.peek() == nil || p.peek().Value != ":" {
+			p.errorf(":", tokenDesc(p.peek()), "expected ':' after schema field key %q", keyToken.Value)
+			p.recoverBlockField()
+			continue
+		}
+		p.consume() // consume ':'
+
+		value := p.parseSchema()
+		if value == nil {
+			p.errorf("a type", tokenDesc(p.peek()), "expected a type for schema field %q", keyToken.Value)
+			p.recoverBlockField()
+			continue
+		}
+
+		if p.peek() != nil && p.peek().Value == "@" {
+			annotations := make(map[string]*ASTNode)
+			for p.peek() != nil && p.peek().Value == "@" {
+				p.consume() // consume '@'
+				annKey := p.consume()
+				if annKey == nil {
+					break
+				}
+				if p.peek() != nil && p.peek().Value == ":" {
+					p.consume() // consume ':'
+					annotations[annKey.Value] = p.parseValue()
+				} else {
+					annotations[annKey.Value] = &ASTNode{Kind: ASTValue, Val: true}
+				}
+			}
+			value.Annotations = annotations
+		}
+
+		node.BlockFields[keyToken.Value] = value
+
+		// Optional comma
+		if p.peek() != nil && p.peek().Value == "," {
+			p.consume()
+		}
+	}
+
+	if p.peek() != nil && p.peek().Value == "}" {
+		p.consume() // consume '}'
+	} else {
+		p.fatalf("}", "end of input", "expected '}' to close schema block")
+	}
+
+	return node
+}
+
+// FormatOptions controls FormatDSL's output.
+type FormatOptions struct {
+	// IndentWidth is the number of spaces per nesting level. Zero defaults
+	// to 2, matching MCPDSLDecompiler's own block indentation.
+	IndentWidth int
+	// TrailingComma adds a comma after a block's last field, so a diff
+	// that appends one more field doesn't also touch the line above it.
+	TrailingComma bool
+}
+
+func (o FormatOptions) indentWidth() int {
+	if o.IndentWidth <= 0 {
+		return 2
+	}
+	return o.IndentWidth
+}
+
+// PrettyPrint renders this node back to canonical MCP-DSL source text at
+// nesting depth indent (0 for a top-level message), using FormatDSL's
+// default style (2-space indent, no trailing commas). FormatDSL is the
+// entry point for a whole document and the place to pick a different
+// style.
+func (n *ASTNode) PrettyPrint(indent int) string {
+	return n.print(indent, FormatOptions{})
+}
+
+// FormatDSL canonicalizes a parsed document into stable MCP-DSL source:
+// block fields are emitted in sorted key order (Go map iteration isn't
+// stable across runs), one message per line, styled per opts.
+func FormatDSL(nodes []*ASTNode, opts FormatOptions) string {
+	lines := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		lines = append(lines, n.print(0, opts))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// print is PrettyPrint/FormatDSL's shared recursive implementation.
+func (n *ASTNode) print(indent int, opts FormatOptions) string {
+	switch n.Kind {
+	case ASTRequest:
+		head := "> " + n.ReqMethod
+		if n.ReqID != nil {
+			head += fmt.Sprintf("#%d", *n.ReqID)
+		}
+		if n.ReqParams != nil {
+			head += " " + n.ReqParams.printValue(indent, opts)
+		}
+		return head
+	case ASTResponse:
+		head := fmt.Sprintf("< #%d", n.RespID)
+		if n.RespResult != nil {
+			head += " " + n.RespResult.printValue(indent, opts)
+		}
+		return head
+	case ASTNotification:
+		head := "! " + n.NotifMethod
+		if n.NotifParams != nil {
+			head += " " + n.NotifParams.printValue(indent, opts)
+		}
+		return head
+	case ASTError:
+		return fmt.Sprintf("x #%d %d:%s", n.ErrID, n.ErrCode, quoteDSLString(n.ErrMessage))
+	case ASTTool:
+		return n.printDefinition("T", indent, opts)
 	case ASTResource:
-		return c.compileResource(node)
+		return n.printDefinition("R", indent, opts)
 	case ASTPrompt:
-		return c.compilePrompt(node)
+		return n.printDefinition("P", indent, opts)
+	case ASTType:
+		return n.printDefinition("Type", indent, opts)
+	case ASTBatch:
+		return n.printBatch(indent, opts)
+	default:
+		return n.printValue(indent, opts)
+	}
+}
+
+// printBatch renders a "[[ ... ]]" block, one enclosed message per line.
+func (n *ASTNode) printBatch(indent int, opts FormatOptions) string {
+	pad := strings.Repeat(" ", indent*opts.indentWidth())
+	innerPad := strings.Repeat(" ", (indent+1)*opts.indentWidth())
+
+	var b strings.Builder
+	b.WriteString("[[\n")
+	for _, msg := range n.BatchMessages {
+		b.WriteString(innerPad)
+		b.WriteString(msg.print(indent+1, opts))
+		b.WriteString("\n")
+	}
+	b.WriteString(pad)
+	b.WriteString("]]")
+	return b.String()
+}
+
+// definitionSchemaFields are the DefFields keys whose value is schema type
+// syntax (e.g. "str!", "[int!]") rather than a literal value, so they print
+// via printSchemaType instead of printValue.
+var definitionSchemaFields = map[string]bool{"in": true, "out": true}
+
+// printDefinition renders a "T"/"R"/"P"/"Type" definition, sorting
+// DefFields so the output doesn't depend on Go's randomized map order.
+func (n *ASTNode) printDefinition(sigil string, indent int, opts FormatOptions) string {
+	pad := strings.Repeat(" ", indent*opts.indentWidth())
+	innerPad := strings.Repeat(" ", (indent+1)*opts.indentWidth())
+
+	var b strings.Builder
+	b.WriteString(sigil)
+	b.WriteString(" ")
+	b.WriteString(n.DefName)
+	b.WriteString(" {\n")
+
+	keys := sortedASTKeys(n.DefFields)
+	for _, key := range keys {
+		value := n.DefFields[key]
+		b.WriteString(innerPad)
+		b.WriteString(key)
+		b.WriteString(": ")
+		if definitionSchemaFields[key] {
+			b.WriteString(value.printSchemaType(indent+1, opts))
+		} else {
+			b.WriteString(value.printValue(indent+1, opts))
+		}
+		b.WriteString("\n")
+	}
+
+	for _, key := range sortedAnnotationKeys(n.Annotations) {
+		b.WriteString(innerPad)
+		b.WriteString(printAnnotation(key, n.Annotations[key], opts))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(pad)
+	b.WriteString("}")
+	return b.String()
+}
+
+// printAnnotation renders a single "@key" or "@key: value" constraint.
+func printAnnotation(key string, value *ASTNode, opts FormatOptions) string {
+	if value != nil && value.Kind == ASTValue && value.Val == true {
+		return "@" + key
+	}
+	if value == nil {
+		return "@" + key
+	}
+	return "@" + key + ": " + value.printValue(0, opts)
+}
+
+// printValue renders n as a literal value: a quoted string, a number, a
+// bool, an array, a nested object of further literal values, an enum, or a
+// "$..." expression placeholder. This is the value-position counterpart to
+// printSchemaType, mirroring compileBlock/compileNode vs compileSchema.
+func (n *ASTNode) printValue(indent int, opts FormatOptions) string {
+	switch n.Kind {
 	case ASTBlock:
-		return c.compileBlock(node)
+		return n.printBlockFields(indent, opts, false)
 	case ASTValue:
-		return node.Val
+		return printLiteral(n.Val, indent, opts)
+	case ASTEnum:
+		return printEnumValue(n, indent, opts)
+	case ASTExpr:
+		return "$" + n.ExprSource
+	}
+	return ""
+}
+
+// printSchemaType renders n as type syntax inside an "in:"/"out:" schema:
+// a bare type token ("str!"), an array type ("[str]"), a nested object
+// schema, or an enum union. Mirrors compileFieldSchema's switch.
+func (n *ASTNode) printSchemaType(indent int, opts FormatOptions) string {
+	switch n.Kind {
+	case ASTBlock:
+		return n.printBlockFields(indent, opts, true)
+	case ASTSchema:
+		return n.printSchemaNode(indent, opts)
+	case ASTEnum:
+		return printEnumValue(n, indent, opts)
+	case ASTValue:
+		switch typed := n.Val.(type) {
+		case []interface{}:
+			var items []string
+			for _, item := range typed {
+				items = append(items, fmt.Sprint(item))
+			}
+			return "[" + strings.Join(items, ", ") + "]"
+		default:
+			return fmt.Sprint(typed)
+		}
+	}
+	return ""
+}
+
+// printSchemaNode renders an ASTSchema node (see parseSchema) as schema
+// type syntax: a union, an array, an enum(...), a "&Name" ref, or a
+// primitive with its trailing "!"/"?" and "(...)" constraint, if any.
+func (n *ASTNode) printSchemaNode(indent int, opts FormatOptions) string {
+	switch {
+	case len(n.SchemaUnion) > 0:
+		parts := make([]string, len(n.SchemaUnion))
+		for i, member := range n.SchemaUnion {
+			parts[i] = member.printSchemaType(indent, opts)
+		}
+		// The trailing '!'/'?' always lands on the last member itself
+		// (see parseSchema), so nothing more needs appending here.
+		return strings.Join(parts, "|")
+
+	case n.SchemaItems != nil:
+		return "[" + n.SchemaItems.printSchemaType(indent, opts) + "]"
+
+	case len(n.SchemaEnumWords) > 0:
+		return "enum(" + strings.Join(n.SchemaEnumWords, "|") + ")" + n.schemaSuffix()
+
+	case n.SchemaRef != "":
+		return "&" + n.SchemaRef + n.schemaSuffix()
+	}
+
+	baseType, _ := n.Val.(string)
+	body := baseType
+	switch {
+	case n.SchemaPattern != "":
+		body += "(/" + n.SchemaPattern + "/)"
+	case n.SchemaMin != nil || n.SchemaMax != nil:
+		body += "(" + formatSchemaRange(n.SchemaMin, n.SchemaMax) + ")"
+	}
+	return body + n.schemaSuffix()
+}
+
+// schemaSuffix renders an ASTSchema node's trailing '!'/'?' modifiers.
+func (n *ASTNode) schemaSuffix() string {
+	suffix := ""
+	if n.Required {
+		suffix += "!"
+	}
+	if n.Nullable {
+		suffix += "?"
+	}
+	return suffix
+}
+
+// formatSchemaRange renders a numeric constraint's "lo..hi" bounds, leaving
+// either side blank if unset (parseSchemaConstraint leaves a side unset
+// when its half of the "lo..hi" token isn't a number, e.g. "(0..)").
+func formatSchemaRange(min, max *float64) string {
+	lo, hi := "", ""
+	if min != nil {
+		lo = strconv.FormatFloat(*min, 'f', -1, 64)
+	}
+	if max != nil {
+		hi = strconv.FormatFloat(*max, 'f', -1, 64)
+	}
+	return lo + ".." + hi
+}
+
+// printEnumValue renders a str|"a"|"b"|"c"-style union: the base type as
+// schema syntax, each alternative as a quoted/typed literal value.
+func printEnumValue(n *ASTNode, indent int, opts FormatOptions) string {
+	baseType, _ := n.Val.(string)
+	var b strings.Builder
+	b.WriteString(baseType)
+	for _, lit := range n.EnumValues {
+		b.WriteString("|")
+		b.WriteString(printLiteral(lit, indent, opts))
+	}
+	return b.String()
+}
+
+// printBlockFields renders a "{ key: value, ... }" block. schemaType
+// selects whether values print via printSchemaType (nested schema objects)
+// or printValue (literal nested objects), and whether a nested object's
+// Required flag prints as a trailing "!".
+func (n *ASTNode) printBlockFields(indent int, opts FormatOptions, schemaType bool) string {
+	keys := sortedASTKeys(n.BlockFields)
+	if len(keys) == 0 {
+		return "{}"
+	}
+
+	pad := strings.Repeat(" ", indent*opts.indentWidth())
+	innerPad := strings.Repeat(" ", (indent+1)*opts.indentWidth())
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i, key := range keys {
+		value := n.BlockFields[key]
+		b.WriteString(innerPad)
+		b.WriteString(key)
+		b.WriteString(": ")
+		if schemaType {
+			b.WriteString(value.printSchemaType(indent+1, opts))
+		} else {
+			b.WriteString(value.printValue(indent+1, opts))
+		}
+		if value.Kind == ASTBlock && value.Required {
+			b.WriteString("!")
+		}
+		for _, annKey := range sortedAnnotationKeys(value.Annotations) {
+			b.WriteString(" ")
+			b.WriteString(printAnnotation(annKey, value.Annotations[annKey], opts))
+		}
+		if i < len(keys)-1 || opts.TrailingComma {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(pad)
+	b.WriteString("}")
+	return b.String()
+}
+
+// printLiteral renders a Go value produced by parsePrimaryValue/parseArray
+// (string, float64, bool, or []interface{}) as a literal MCP-DSL value.
+func printLiteral(val interface{}, indent int, opts FormatOptions) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quoteDSLString(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]"
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = printLiteral(item, indent, opts)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteDSLString renders s as a double-quoted MCP-DSL string literal.
+// Only '\' and '"' get a backslash; every other character, a newline
+// included, is written as-is, which readString reads back verbatim since
+// only a bare '"' ends the literal.
+func quoteDSLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// sortedASTKeys returns m's keys in sorted order, for deterministic output
+// over a map whose iteration order Go deliberately randomizes.
+func sortedASTKeys(m map[string]*ASTNode) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedAnnotationKeys is sortedASTKeys for an Annotations map.
+func sortedAnnotationKeys(m map[string]*ASTNode) []string {
+	return sortedASTKeys(m)
+}
+
+// typeRegistry indexes named, reusable schemas by name: standalone "Type
+// Name { ... }" declarations, and tool "in:" blocks indexed under the
+// tool's own name, so either can be referenced by name ($ref) from other
+// "in:" blocks. It's built once per Compile/CompileConcurrent call and
+// passed down the call stack rather than stored on the compiler, so
+// MCPDSLCompiler itself holds no per-call state and is safe to reuse
+// concurrently.
+type typeRegistry map[string]map[string]*ASTNode
+
+// exprEnv carries everything compileNode needs to resolve "$..." value
+// expressions (see mcp_expr.go): the prior messages they can reference, and
+// where to record evaluation errors. It's threaded through the same call
+// graph as typeRegistry so MCPDSLCompiler stays free of per-call state; the
+// zero value (nil ctx) means "no context was supplied", in which case
+// expressions compile to a $ref placeholder instead of being evaluated.
+type exprEnv struct {
+	ctx  MessageContext
+	errs *[]EvalError
+}
+
+// MCPDSLCompiler compiles AST to JSON-RPC. It carries no state of its own,
+// so the same instance can be shared and compiled from concurrently.
+type MCPDSLCompiler struct{}
+
+// NewMCPDSLCompiler creates a new compiler
+func NewMCPDSLCompiler() *MCPDSLCompiler {
+	return &MCPDSLCompiler{}
+}
+
+// Compile compiles AST nodes to JSON-RPC. Type declarations don't produce a
+// JSON-RPC message of their own; they're indexed for $ref resolution and
+// then dropped from the output. Any "$..." expression value compiles to a
+// {"$ref": "<source>"} placeholder, since no MessageContext is supplied;
+// use CompileWithContext to evaluate expressions against prior messages.
+func (c *MCPDSLCompiler) Compile(nodes []*ASTNode) interface{} {
+	result, _ := c.CompileWithContext(nodes, nil)
+	return result
+}
+
+// CompileWithContext compiles nodes the same way Compile does, but
+// evaluates "$..." expression values against ctx instead of emitting a
+// placeholder. ctx is seeded with the caller's prior messages and then
+// grows as each ASTResponse in nodes is compiled, so a later message can
+// reference an earlier one from within the same call even if ctx started
+// empty. It returns every EvalError encountered alongside the result,
+// mirroring how ParseMCPDSLWithOptions returns parse errors alongside the
+// parsed value.
+func (c *MCPDSLCompiler) CompileWithContext(nodes []*ASTNode, ctx MessageContext) (interface{}, []EvalError) {
+	types := collectTypes(nodes)
+
+	var working MessageContext
+	if ctx != nil {
+		working = make(MessageContext, len(ctx))
+		for k, v := range ctx {
+			working[k] = v
+		}
+	}
+
+	var errs []EvalError
+	env := exprEnv{ctx: working, errs: &errs}
+
+	var compilable []*ASTNode
+	for _, node := range nodes {
+		if node.Kind != ASTType {
+			compilable = append(compilable, node)
+		}
+	}
+
+	var results []interface{}
+	for _, node := range compilable {
+		compiled := c.compileNode(node, types, env)
+		if working != nil && node.Kind == ASTResponse {
+			working[node.RespID] = compiled
+		}
+		results = append(results, compiled)
+	}
+
+	if len(results) == 1 {
+		return results[0], errs
+	}
+	return results, errs
+}
+
+// CompileConcurrent compiles each node independently across a pool of
+// workers, writing each result to its own slot of the returned slice so
+// the ordering matches nodes regardless of completion order. Every node is
+// compiled against types collected from the full nodes slice up front, the
+// same as Compile, so a $ref still resolves no matter which goroutine
+// compiles the referencing node. It doesn't accept a MessageContext — since
+// nodes compile out of order across goroutines, there's no well-defined
+// "prior messages" set to build incrementally; "$..." expressions always
+// compile to a placeholder here. Use CompileWithContext for those.
+func (c *MCPDSLCompiler) CompileConcurrent(nodes []*ASTNode, workers int) []interface{} {
+	types := collectTypes(nodes)
+	results := make([]interface{}, len(nodes))
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = c.compileNode(nodes[i], types, exprEnv{})
+			}
+		}()
+	}
+
+	for i := range nodes {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return results
+}
+
+// collectTypes indexes every reusable named schema in the document so
+// compileSchema can resolve $ref-style references regardless of
+// declaration order.
+func collectTypes(nodes []*ASTNode) typeRegistry {
+	types := make(typeRegistry)
+	for _, node := range nodes {
+		switch node.Kind {
+		case ASTType:
+			types[node.DefName] = node.DefFields
+		case ASTTool:
+			if inSchema, ok := node.DefFields["in"]; ok && inSchema.Kind == ASTBlock {
+				types[node.DefName] = inSchema.BlockFields
+			}
+		}
+	}
+	return types
+}
+
+// resolveSchemaRefs walks every Type/Tool schema in nodes looking for
+// explicit "&Name" references (see ASTNode.SchemaRef) and reports a
+// Diagnostic for any that names an undeclared type or that takes part in a
+// reference cycle. It's a semantic pass run after parsing proper (see
+// ParseMCPDSLWithOptions), since validating refs needs the full type
+// registry rather than whatever's been seen so far in a single top-down
+// parse. The older implicit bare-name $ref (e.g. "addr: Address!",
+// resolved by compileTypeString) predates this resolver and isn't covered
+// by it — an unresolved bare name still compiles best-effort rather than
+// erroring, as before.
+func resolveSchemaRefs(nodes []*ASTNode) []Diagnostic {
+	types := collectTypes(nodes)
+
+	graph := make(map[string][]string, len(types))
+	for name, fields := range types {
+		graph[name] = collectExplicitRefs(fields)
+	}
+
+	var diags []Diagnostic
+	for name, refs := range graph {
+		for _, ref := range refs {
+			if _, ok := types[ref]; !ok {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("schema %q references undeclared type %q via '&'", name, ref),
+					Code:     "undeclared-type-ref",
+					Hint:     fmt.Sprintf("declare %q with a top-level Type/Tool definition", ref),
+				})
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(graph))
+	for name := range graph {
+		if cycle, ok := findSchemaRefCycle(name, graph, seen, nil); ok {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("cyclic schema reference: %s", strings.Join(cycle, " -> ")),
+				Code:     "cyclic-type-ref",
+				Hint:     "remove one '&' reference from the cycle",
+			})
+		}
+	}
+
+	return diags
+}
+
+// collectExplicitRefs recursively finds every "&Name" SchemaRef reachable
+// from fields, including through arrays, unions, and nested objects.
+func collectExplicitRefs(fields map[string]*ASTNode) []string {
+	var refs []string
+	var walk func(node *ASTNode)
+	walk = func(node *ASTNode) {
+		if node == nil {
+			return
+		}
+		if node.SchemaRef != "" {
+			refs = append(refs, node.SchemaRef)
+		}
+		if node.SchemaItems != nil {
+			walk(node.SchemaItems)
+		}
+		for _, member := range node.SchemaUnion {
+			walk(member)
+		}
+		if node.Kind == ASTBlock {
+			for _, field := range node.BlockFields {
+				walk(field)
+			}
+		}
+	}
+	for _, field := range fields {
+		walk(field)
+	}
+	return refs
+}
+
+// findSchemaRefCycle does a DFS from start over graph's "&Name" edges
+// looking for a path back to a type already on the current path. seen
+// records types already proven cycle-free so they're never walked twice
+// across calls from resolveSchemaRefs' outer loop.
+func findSchemaRefCycle(start string, graph map[string][]string, seen map[string]bool, path []string) ([]string, bool) {
+	if seen[start] {
+		return nil, false
+	}
+	for _, p := range path {
+		if p == start {
+			return append(append([]string{}, path...), start), true
+		}
+	}
+
+	path = append(path, start)
+	for _, next := range graph[start] {
+		if _, ok := graph[next]; !ok {
+			continue // unresolved ref, already reported separately
+		}
+		if cycle, ok := findSchemaRefCycle(next, graph, seen, path); ok {
+			return cycle, true
+		}
+	}
+	seen[start] = true
+	return nil, false
+}
+
+// compileNode compiles a single AST node
+func (c *MCPDSLCompiler) compileNode(node *ASTNode, types typeRegistry, env exprEnv) interface{} {
+	switch node.Kind {
+	case ASTRequest:
+		return c.compileRequest(node, env)
+	case ASTResponse:
+		return c.compileResponse(node, env)
+	case ASTNotification:
+		return c.compileNotification(node, env)
+	case ASTError:
+		return c.compileError(node)
+	case ASTTool:
+		return c.compileTool(node, types)
+	case ASTResource:
+		return c.compileResource(node, env)
+	case ASTPrompt:
+		return c.compilePrompt(node, env)
+	case ASTBlock:
+		return c.compileBlock(node, env)
+	case ASTValue:
+		return node.Val
+	case ASTExpr:
+		return c.compileExpr(node, env)
+	case ASTBatch:
+		return c.compileBatch(node, types, env)
+	}
+	return nil
+}
+
+// compileBatch compiles a "[[ ... ]]" block into a single JSON array value,
+// one JSON-RPC 2.0 batch frame. Per the JSON-RPC 2.0 spec, a batch must
+// never be an empty array on the wire; an empty "[[ ]]" instead compiles to
+// the synthesized "Invalid Request" error a server would send back for it.
+func (c *MCPDSLCompiler) compileBatch(node *ASTNode, types typeRegistry, env exprEnv) interface{} {
+	if len(node.BatchMessages) == 0 {
+		return map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      nil,
+			"error": map[string]interface{}{
+				"code":    -32600,
+				"message": "Invalid Request",
+			},
+		}
+	}
+
+	batch := make([]interface{}, 0, len(node.BatchMessages))
+	for _, msg := range node.BatchMessages {
+		batch = append(batch, c.compileNode(msg, types, env))
+	}
+	return batch
+}
+
+// compileExpr resolves a "$..." expression value. With no MessageContext
+// supplied (env.ctx == nil), it emits a {"$ref": "<source>"} placeholder
+// instead of evaluating — the same shape compileTypeString uses for a named
+// Type reference, so downstream tooling can treat both uniformly. Any
+// EvalError is appended to env.errs (when non-nil) and still yields a
+// placeholder, so one bad expression doesn't abort the rest of the compile.
+func (c *MCPDSLCompiler) compileExpr(node *ASTNode, env exprEnv) interface{} {
+	expr, _ := node.Val.(*Expr)
+	placeholder := map[string]interface{}{"$ref": node.ExprSource}
+
+	if env.ctx == nil || expr == nil {
+		return placeholder
+	}
+
+	result, err := EvalExpr(expr, env.ctx)
+	if err != nil {
+		if env.errs != nil {
+			if evalErr, ok := err.(EvalError); ok {
+				*env.errs = append(*env.errs, evalErr)
+			} else {
+				*env.errs = append(*env.errs, EvalError{Message: err.Error()})
+			}
+		}
+		return placeholder
+	}
+
+	return result
+}
+
+// compileRequest compiles a request node
+func (c *MCPDSLCompiler) compileRequest(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  node.ReqMethod,
+	}
+
+	if node.ReqID != nil {
+		result["id"] = *node.ReqID
+	}
+
+	if node.ReqParams != nil {
+		// ReqParams is usually the object block compileBlock expects, but
+		// JSON-RPC also allows positional (array) params, which parseValue
+		// hands back as an ASTValue instead — compileNode dispatches on
+		// whichever this is. The v/caps/info/args key remapping below only
+		// makes sense for named (object) params, so it's skipped otherwise.
+		compiled := c.compileNode(node.ReqParams, nil, env)
+		params, ok := compiled.(map[string]interface{})
+		if !ok {
+			result["params"] = compiled
+			return result
+		}
+
+		// Create new params map with transformed keys
+		transformedParams := make(map[string]interface{})
+
+		for key, val := range params {
+			switch key {
+			case "v":
+				transformedParams["protocolVersion"] = val
+			case "caps":
+				transformedParams["capabilities"] = val
+			case "info":
+				if node.ReqMethod == "initialize" {
+					transformedParams["clientInfo"] = val
+				} else {
+					transformedParams["serverInfo"] = val
+				}
+			case "args":
+				transformedParams["arguments"] = val
+			default:
+				transformedParams[key] = val
+			}
+		}
+
+		result["params"] = transformedParams
+	}
+
+	return result
+}
+
+// compileResponse compiles a response node
+func (c *MCPDSLCompiler) compileResponse(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      node.RespID,
+	}
+
+	if node.RespResult != nil {
+		// RespResult is usually the object block compileBlock expects, but a
+		// JSON-RPC result can be any JSON value, which parseValue hands back
+		// as an ASTValue instead (array, string, number, bool) — compileNode
+		// dispatches on whichever this is. The v/caps/info/ok key remapping
+		// below only makes sense for an object result, so it's skipped
+		// otherwise.
+		compiled := c.compileNode(node.RespResult, nil, env)
+		resultData, ok := compiled.(map[string]interface{})
+		if !ok {
+			result["result"] = compiled
+			return result
+		}
+
+		// Create new result map with transformed keys
+		transformedResult := make(map[string]interface{})
+
+		for key, val := range resultData {
+			switch key {
+			case "v":
+				transformedResult["protocolVersion"] = val
+			case "caps":
+				transformedResult["capabilities"] = val
+			case "info":
+				transformedResult["serverInfo"] = val
+			case "ok":
+				if boolVal, ok := val.(bool); ok {
+					transformedResult["isError"] = !boolVal
+				}
+			default:
+				transformedResult[key] = val
+			}
+		}
+
+		result["result"] = transformedResult
+	}
+
+	return result
+}
+
+// compileNotification compiles a notification node
+func (c *MCPDSLCompiler) compileNotification(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  node.NotifMethod,
+	}
+
+	if node.NotifParams != nil {
+		// No key remapping here (unlike compileRequest), so NotifParams can
+		// go straight through compileNode regardless of whether it's the
+		// usual object block or an ASTValue array/scalar.
+		result["params"] = c.compileNode(node.NotifParams, nil, env)
+	}
+
+	return result
+}
+
+// compileError compiles an error node
+func (c *MCPDSLCompiler) compileError(node *ASTNode) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      node.ErrID,
+		"error": map[string]interface{}{
+			"code":    node.ErrCode,
+			"message": node.ErrMessage,
+		},
+	}
+}
+
+// toolHintAnnotations maps a tool's "@key"/"@key: value" annotation name to
+// its JSON Schema tool-annotation hint, the reverse of decompileTool's own
+// readOnlyHint/idempotentHint/destructiveHint/openWorldHint handling.
+var toolHintAnnotations = map[string]string{
+	"readonly":    "readOnlyHint",
+	"idempotent":  "idempotentHint",
+	"destructive": "destructiveHint",
+	"openWorld":   "openWorldHint",
+}
+
+// compileTool compiles a tool definition
+func (c *MCPDSLCompiler) compileTool(node *ASTNode, types typeRegistry) map[string]interface{} {
+	result := map[string]interface{}{
+		"name": node.DefName,
+	}
+
+	if desc, ok := node.DefFields["desc"]; ok {
+		result["description"] = c.compileNode(desc, nil, exprEnv{})
+	}
+
+	if inSchema, ok := node.DefFields["in"]; ok {
+		schema := compileSchema(inSchema, types)
+		if schema != nil {
+			resolveDefinitions(schema, types)
+		}
+		result["inputSchema"] = schema
+	}
+
+	if outSchema, ok := node.DefFields["out"]; ok {
+		schema := compileSchema(outSchema, types)
+		if schema != nil {
+			resolveDefinitions(schema, types)
+		}
+		result["outputSchema"] = schema
+	}
+
+	if len(node.Annotations) > 0 {
+		annotations := make(map[string]interface{})
+		for key, value := range node.Annotations {
+			hint, ok := toolHintAnnotations[key]
+			if !ok {
+				continue
+			}
+			annotations[hint] = c.compileNode(value, nil, exprEnv{})
+		}
+		if len(annotations) > 0 {
+			result["annotations"] = annotations
+		}
+	}
+
+	return result
+}
+
+// compileResource compiles a resource definition
+func (c *MCPDSLCompiler) compileResource(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := map[string]interface{}{
+		"name": node.DefName,
+	}
+
+	for key, value := range node.DefFields {
+		switch key {
+		case "uri":
+			result["uri"] = c.compileNode(value, nil, env)
+		case "mime":
+			result["mimeType"] = c.compileNode(value, nil, env)
+		case "desc":
+			result["description"] = c.compileNode(value, nil, env)
+		case "size":
+			result["size"] = c.compileNode(value, nil, env)
+		case "extra":
+			// The Lossless decompiler's catch-all for fields it doesn't
+			// otherwise render; merge its fields back into the top level
+			// instead of nesting them under "extra" in the recompiled JSON.
+			if value.Kind == ASTBlock {
+				for extraKey, extraVal := range value.BlockFields {
+					result[extraKey] = c.compileNode(extraVal, nil, env)
+				}
+			}
+		}
+	}
+
+	if len(node.Annotations) > 0 {
+		annotations := make(map[string]interface{})
+		for key, value := range node.Annotations {
+			annotations[key] = c.compileNode(value, nil, env)
+		}
+		result["annotations"] = annotations
+	}
+
+	return result
+}
+
+// compilePrompt compiles a prompt definition
+func (c *MCPDSLCompiler) compilePrompt(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := map[string]interface{}{
+		"name": node.DefName,
+	}
+
+	for key, value := range node.DefFields {
+		result[key] = c.compileNode(value, nil, env)
+	}
+
+	return result
+}
+
+// compileBlock compiles a block node
+func (c *MCPDSLCompiler) compileBlock(node *ASTNode, env exprEnv) map[string]interface{} {
+	result := make(map[string]interface{})
+
+	for key, value := range node.BlockFields {
+		result[key] = c.compileNode(value, nil, env)
+	}
+
+	return result
+}
+
+// primitiveJSONTypes maps a bare DSL type name to its JSON Schema "type".
+var primitiveJSONTypes = map[string]string{
+	"str":  "string",
+	"int":  "integer",
+	"num":  "number",
+	"bool": "boolean",
+}
+
+// compileSchema compiles a schema definition (the contents of an "in:"
+// block, a nested object field, or a named Type declaration) into a JSON
+// Schema object. It takes no receiver and mutates no shared state, so it's
+// safe to call concurrently for different nodes with the same types.
+func compileSchema(node *ASTNode, types typeRegistry) map[string]interface{} {
+	if node.Kind != ASTBlock {
+		return nil
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": make(map[string]interface{}),
+	}
+
+	var required []string
+
+	for key, value := range node.BlockFields {
+		propSchema, isRequired := compileFieldSchema(value, types)
+		if propSchema == nil {
+			continue
+		}
+
+		schema["properties"].(map[string]interface{})[key] = propSchema
+		if isRequired {
+			required = append(required, key)
+		}
+	}
+
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+// compileFieldSchema compiles a single field's declared type — scalar,
+// array, enum, nested object, or a $ref to a named Type/Tool — into its
+// JSON Schema representation, applying any @min/@max/@pattern/@format
+// constraint annotations that were attached to it.
+func compileFieldSchema(value *ASTNode, types typeRegistry) (map[string]interface{}, bool) {
+	var propSchema map[string]interface{}
+	var isRequired bool
+
+	switch {
+	case value.Kind == ASTValue:
+		switch typed := value.Val.(type) {
+		case string:
+			propSchema, isRequired = compileTypeString(typed, types)
+		case []interface{}:
+			propSchema, isRequired = compileArrayType(typed, types)
+		default:
+			return nil, false
+		}
+	case value.Kind == ASTEnum:
+		propSchema, isRequired = compileEnumType(value, types)
+	case value.Kind == ASTSchema:
+		propSchema, isRequired = compileSchemaNode(value, types)
+	case value.Kind == ASTBlock:
+		propSchema = compileSchema(value, types)
+		isRequired = value.Required
+	default:
+		return nil, false
+	}
+
+	if propSchema == nil {
+		return nil, false
+	}
+
+	applyConstraints(propSchema, value.Annotations)
+	return propSchema, isRequired
+}
+
+// compileTypeString resolves a bare type token (e.g. "str!", "Address!")
+// to its JSON Schema form: a primitive type, or a $ref if the name matches
+// a declared Type or Tool. The trailing "!" marks the field required.
+func compileTypeString(typeStr string, types typeRegistry) (map[string]interface{}, bool) {
+	isRequired := strings.HasSuffix(typeStr, "!")
+	typeStr = strings.TrimSuffix(typeStr, "!")
+
+	if jsonType, ok := primitiveJSONTypes[typeStr]; ok {
+		return map[string]interface{}{"type": jsonType}, isRequired
+	}
+
+	if _, ok := types[typeStr]; ok {
+		return map[string]interface{}{"$ref": "#/definitions/" + typeStr}, isRequired
+	}
+
+	return nil, isRequired
+}
+
+// compileArrayType compiles an array-of-type declaration (e.g. "[str]",
+// "[int!]"); the trailing "!" on the item type marks the array field
+// itself required.
+func compileArrayType(items []interface{}, types typeRegistry) (map[string]interface{}, bool) {
+	if len(items) == 0 {
+		return map[string]interface{}{"type": "array"}, false
+	}
+
+	itemTypeStr, ok := items[0].(string)
+	if !ok {
+		return map[string]interface{}{"type": "array"}, false
+	}
+
+	itemSchema, isRequired := compileTypeString(itemTypeStr, types)
+	return map[string]interface{}{
+		"type":  "array",
+		"items": itemSchema,
+	}, isRequired
+}
+
+// compileEnumType compiles a union-of-literals type (e.g. str|"a"|"b"|"c")
+// into a JSON Schema "enum".
+func compileEnumType(value *ASTNode, types typeRegistry) (map[string]interface{}, bool) {
+	baseType, _ := value.Val.(string)
+	propSchema, isRequired := compileTypeString(baseType, types)
+	if propSchema == nil {
+		propSchema = make(map[string]interface{})
+	}
+	propSchema["enum"] = value.EnumValues
+	return propSchema, isRequired
+}
+
+// compileSchemaNode compiles a single ASTSchema node (see parseSchema) to
+// its JSON Schema representation, mirroring compileFieldSchema's (schema,
+// required) shape so compileSchema's per-field loop doesn't need to care
+// which grammar produced the field.
+func compileSchemaNode(node *ASTNode, types typeRegistry) (map[string]interface{}, bool) {
+	if node == nil {
+		return nil, false
+	}
+
+	var schema map[string]interface{}
+	required := node.Required
+
+	switch {
+	case len(node.SchemaUnion) > 0:
+		oneOf := make([]interface{}, 0, len(node.SchemaUnion))
+		for _, member := range node.SchemaUnion {
+			memberSchema, memberRequired := compileSchemaNode(member, types)
+			if memberSchema != nil {
+				oneOf = append(oneOf, memberSchema)
+			}
+			// A trailing '!' always parses onto the last union member
+			// rather than the union node itself (see parseSchema), so
+			// whether the field as a whole is required comes from its
+			// members, not node.Required.
+			required = required || memberRequired
+		}
+		schema = map[string]interface{}{"oneOf": oneOf}
+
+	case node.SchemaItems != nil:
+		itemSchema, _ := compileSchemaNode(node.SchemaItems, types)
+		schema = map[string]interface{}{"type": "array", "items": itemSchema}
+
+	case len(node.SchemaEnumWords) > 0:
+		words := make([]interface{}, len(node.SchemaEnumWords))
+		for i, w := range node.SchemaEnumWords {
+			words[i] = w
+		}
+		schema = map[string]interface{}{"type": "string", "enum": words}
+
+	case node.SchemaRef != "":
+		// An unresolved or cyclic "&Name" is reported separately by
+		// resolveSchemaRefs; compiling still emits a best-effort $ref
+		// rather than silently dropping the field.
+		schema = map[string]interface{}{"$ref": "#/definitions/" + node.SchemaRef}
+
+	case node.Kind == ASTBlock:
+		schema = compileSchema(node, types)
+
+	default:
+		baseType, _ := node.Val.(string)
+		if jsonType, ok := primitiveJSONTypes[baseType]; ok {
+			schema = map[string]interface{}{"type": jsonType}
+		} else if _, ok := types[baseType]; ok {
+			schema = map[string]interface{}{"$ref": "#/definitions/" + baseType}
+		} else {
+			schema = map[string]interface{}{"type": baseType}
+		}
+		if node.SchemaMin != nil {
+			schema["minimum"] = *node.SchemaMin
+		}
+		if node.SchemaMax != nil {
+			schema["maximum"] = *node.SchemaMax
+		}
+		if node.SchemaPattern != "" {
+			schema["pattern"] = node.SchemaPattern
+		}
+		if node.Nullable {
+			if t, ok := schema["type"].(string); ok {
+				schema["type"] = []interface{}{t, "null"}
+			}
+		}
+	}
+
+	if schema != nil {
+		applyConstraints(schema, node.Annotations)
+	}
+	return schema, required
+}
+
+// applyConstraints copies @min/@max/@pattern/@format annotations onto a
+// compiled property schema as their JSON Schema equivalents.
+func applyConstraints(schema map[string]interface{}, annotations map[string]*ASTNode) {
+	for name, value := range annotations {
+		switch name {
+		case "min":
+			schema["minimum"] = value.Val
+		case "max":
+			schema["maximum"] = value.Val
+		case "pattern":
+			schema["pattern"] = value.Val
+		case "format":
+			schema["format"] = value.Val
+		}
+	}
+}
+
+// resolveDefinitions walks a compiled schema for "$ref" pointers and adds
+// a "definitions" section with the referenced Type/Tool schemas, so the
+// result is a self-contained JSON Schema document.
+func resolveDefinitions(schema map[string]interface{}, types typeRegistry) {
+	refs := make(map[string]bool)
+	collectRefs(schema, refs)
+	if len(refs) == 0 {
+		return
+	}
+
+	definitions := make(map[string]interface{})
+	for name := range refs {
+		if fields, ok := types[name]; ok {
+			definitions[name] = compileSchema(&ASTNode{Kind: ASTBlock, BlockFields: fields}, types)
+		}
+	}
+
+	if len(definitions) > 0 {
+		schema["definitions"] = definitions
+	}
+}
+
+// collectRefs recursively collects the type names referenced by every
+// "$ref": "#/definitions/Name" pointer found within v.
+func collectRefs(v interface{}, refs map[string]bool) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := val["$ref"].(string); ok {
+			refs[strings.TrimPrefix(ref, "#/definitions/")] = true
+		}
+		for _, sub := range val {
+			collectRefs(sub, refs)
+		}
+	case []interface{}:
+		for _, sub := range val {
+			collectRefs(sub, refs)
+		}
+	}
+}
+
+// ParseOptions controls optional behavior of ParseMCPDSLWithOptions.
+type ParseOptions struct {
+	// NoLocation omits Line/Column from returned Diagnostics, useful for
+	// snapshot tests that shouldn't break when source formatting changes.
+	NoLocation bool
+	// Strict aborts compilation if any Diagnostic was recorded.
+	Strict bool
+}
+
+// ParseMCPDSL is the main entry point for parsing MCP-DSL
+func ParseMCPDSL(input string) interface{} {
+	result, _ := ParseMCPDSLWithOptions(input, ParseOptions{})
+	return result
+}
+
+// ParseMCPDSLWithOptions parses and compiles MCP-DSL input, returning every
+// Diagnostic collected along the way. In Strict mode, any diagnostic aborts
+// compilation and the returned value is nil.
+func ParseMCPDSLWithOptions(input string, opts ParseOptions) (interface{}, []Diagnostic) {
+	lexer := NewMCPDSLLexer(input)
+	tokens := lexer.Tokenize()
+
+	parser := NewMCPDSLParser(tokens)
+	ast, errs := parser.Parse()
+	errs = append(errs, resolveSchemaRefs(ast)...)
+
+	if opts.NoLocation {
+		for i := range errs {
+			errs[i].Line = 0
+			errs[i].Column = 0
+		}
+	}
+
+	if opts.Strict && len(errs) > 0 {
+		return nil, errs
+	}
+
+	compiler := NewMCPDSLCompiler()
+	return compiler.Compile(ast), errs
+}
+
+// ParseErrors aggregates every Diagnostic recorded while parsing one input,
+// each already carrying {Line, Column, Offset, Len, Code, Message, Hint} —
+// everything an LSP-style caller needs to turn a diagnostic into an editor
+// range without re-lexing. It implements error so a caller that only wants
+// pass/fail can treat a *ParseErrors exactly like any other error, while one
+// that wants the detail can range over Errs directly.
+type ParseErrors struct {
+	Errs []Diagnostic
+}
+
+func (e *ParseErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "mcp-dsl: %d parse diagnostic(s):", len(e.Errs))
+	for _, d := range e.Errs {
+		b.WriteString("\n  ")
+		if d.Severity == SeverityFatal {
+			b.WriteString("fatal: ")
+		}
+		if d.Line > 0 {
+			fmt.Fprintf(&b, "%d:%d: ", d.Line, d.Column)
+		}
+		b.WriteString(d.Message)
+	}
+	return b.String()
+}
+
+// ParseMCPDSLStrict parses and compiles input, returning a *ParseErrors
+// instead of a []Diagnostic when anything was recorded, for callers that
+// want plain Go error-handling rather than inspecting diagnostics
+// themselves.
+//
+// This intentionally keeps the (interface{}, error) shape rather than the
+// ([]Message, *ParseErrors) shape once floated for this function: the
+// compiled result here is already whatever well-formed JSON-RPC value the
+// input describes — a single message object, or (since batch support
+// landed) a []interface{} of them for a "[[ ... ]]" block — so introducing
+// a dedicated Message type would mean a parallel representation of exactly
+// what compileNode already produces, with no behavioral gain. What that
+// proposal was actually after — recovery-mode parsing that collects every
+// diagnostic instead of aborting on the first one, and diagnostics precise
+// enough for editor tooling — is here: ParseMCPDSLWithOptions already
+// recovers past a malformed statement to the next top-level sigil (see
+// synchronize), and Diagnostic now carries Offset/Len/Code/Hint alongside
+// Line/Column. *ParseErrors is the concrete type returned below so a caller
+// that wants the full list no longer has to reformat a message string —
+// a type assertion on the returned error gets it directly.
+func ParseMCPDSLStrict(input string) (interface{}, error) {
+	result, errs := ParseMCPDSLWithOptions(input, ParseOptions{Strict: true})
+	if len(errs) == 0 {
+		return result, nil
+	}
+	return nil, &ParseErrors{Errs: errs}
+}
+
+// OrderedObject is a JSON object whose field order survived decoding,
+// unlike the map[string]interface{} json.Unmarshal normally produces (Go
+// map iteration order is randomized). Decode one with DecodeOrderedObject
+// and hand it to Decompile in place of a plain map to get decompiler
+// output that mirrors the original JSON's field order instead of the
+// alphabetical order every plain map falls back to.
+type OrderedObject struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+// Get returns a field's value and whether it was present, mirroring a
+// plain map[string]interface{} index.
+func (o *OrderedObject) Get(key string) (interface{}, bool) {
+	v, ok := o.Values[key]
+	return v, ok
+}
+
+// DecodeOrderedObject reads exactly one JSON object from dec, preserving
+// field order at every nesting level (nested objects, and objects inside
+// arrays, decode to further *OrderedObject values too). dec's own
+// settings, such as UseNumber, are left untouched — DecodeOrderedObject
+// only changes how keys are tracked, not how individual values decode.
+func DecodeOrderedObject(dec *json.Decoder) (*OrderedObject, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("mcp-dsl: expected '{' to start a JSON object, got %v", tok)
+	}
+	return decodeOrderedObjectBody(dec)
+}
+
+func decodeOrderedObjectBody(dec *json.Decoder) (*OrderedObject, error) {
+	obj := &OrderedObject{Values: make(map[string]interface{})}
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return nil, fmt.Errorf("mcp-dsl: expected a string object key, got %v", keyTok)
+		}
+		value, err := decodeOrderedValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		obj.Keys = append(obj.Keys, key)
+		obj.Values[key] = value
+	}
+	_, err := dec.Token() // closing '}'
+	return obj, err
+}
+
+func decodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		return decodeOrderedObjectBody(dec)
+	case '[':
+		var items []interface{}
+		for dec.More() {
+			item, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := dec.Token() // closing ']'
+		return items, err
+	}
+	return tok, nil
+}
+
+// fieldOf looks up key in obj, whether obj is a plain
+// map[string]interface{} or an *OrderedObject (see DecodeOrderedObject).
+func fieldOf(obj interface{}, key string) (interface{}, bool) {
+	switch t := obj.(type) {
+	case map[string]interface{}:
+		v, ok := t[key]
+		return v, ok
+	case *OrderedObject:
+		return t.Get(key)
+	}
+	return nil, false
+}
+
+// asObject normalizes v to a map[string]interface{} for top-level field
+// lookups, which don't care about order; objectKeys/fieldOf are what
+// actually honor an *OrderedObject's order when rendering it back out.
+func asObject(v interface{}) (map[string]interface{}, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return t, true
+	case *OrderedObject:
+		return t.Values, true
+	}
+	return nil, false
+}
+
+// objectKeys returns obj's field names: in their original decode order for
+// an *OrderedObject, sorted otherwise. Every decompiler function that
+// iterates a JSON object goes through this so output stays byte-for-byte
+// deterministic regardless of which shape it was handed.
+func objectKeys(obj interface{}) []string {
+	switch t := obj.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	case *OrderedObject:
+		return t.Keys
+	}
+	return nil
+}
+
+// escapeDSLString renders s as a DSL string literal, the reverse of
+// MCPDSLLexer.readString/StreamingLexer.readString. A string containing a
+// newline is rendered as a """triple-quoted""" heredoc instead, since
+// escaping every embedded "\n" produces an unreadable one-line blob for
+// multi-line prompt/description content; heredocs carry their content
+// verbatim, so no other character needs escaping inside one.
+func escapeDSLString(s string) string {
+	// The heredoc form can't represent a value that itself contains """, nor
+	// one ending in a '"' — readString's heredoc reader scans for the first
+	// run of three quote characters, so either one merges the value's own
+	// trailing quote(s) with the real closing delimiter's leading quote(s)
+	// into a run of three, ending the heredoc early and truncating the
+	// value. Such a string still round-trips fine through the regular
+	// quoted form below: readString doesn't treat a raw newline as
+	// significant, only a bare '"' ends the literal, so the multi-line text
+	// survives unescaped.
+	if strings.ContainsRune(s, '\n') && !strings.Contains(s, `"""`) && !strings.HasSuffix(s, `"`) {
+		return `"""` + s + `"""`
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// MCPDSLDecompiler converts JSON-RPC back to MCP-DSL
+type MCPDSLDecompiler struct{}
+
+// NewMCPDSLDecompiler creates a new decompiler
+func NewMCPDSLDecompiler() *MCPDSLDecompiler {
+	return &MCPDSLDecompiler{}
+}
+
+// DecompileOptions configures Decompile's fidelity, the decompiler
+// counterpart to FormatOptions/ParseOptions.
+type DecompileOptions struct {
+	// Lossless preserves fields Decompile would otherwise silently drop
+	// (e.g. a resource's vendor-specific fields) by emitting them under an
+	// "extra: { ... }" block, so DSL round-tripped back through Compile
+	// reconstructs the original JSON instead of losing that data. Deep
+	// JSON Schema keyword fidelity (enum/format/items/$ref/... beyond the
+	// handful compileSchema/decompileType already cover) is out of scope
+	// here; that's tracked separately as its own piece of work.
+	Lossless bool
+}
+
+// Decompile converts JSON-RPC to DSL using the default (non-lossless)
+// options; see DecompileWithOptions.
+func (d *MCPDSLDecompiler) Decompile(data interface{}) string {
+	return d.DecompileWithOptions(data, DecompileOptions{})
+}
+
+// DecompileWithOptions converts JSON-RPC to DSL under opts.
+func (d *MCPDSLDecompiler) DecompileWithOptions(data interface{}, opts DecompileOptions) string {
+	if data == nil {
+		return ""
+	}
+
+	if arr, ok := data.([]interface{}); ok {
+		return d.decompileBatch(arr, opts)
+	}
+
+	m, ok := asObject(data)
+	if !ok {
+		return ""
+	}
+
+	// Detect message type based on JSON-RPC structure
+	if jsonrpc, ok := m["jsonrpc"].(string); ok && jsonrpc == "2.0" {
+		// Error response
+		if _, hasError := m["error"]; hasError {
+			return d.decompileError(m)
+		}
+		// Response with result
+		if _, hasResult := m["result"]; hasResult {
+			if _, hasID := m["id"]; hasID {
+				return d.decompileResponse(m)
+			}
+		}
+		// Request with id
+		if method, hasMethod := m["method"]; hasMethod {
+			if _, hasID := m["id"]; hasID {
+				return d.decompileRequest(m, method.(string))
+			}
+			// Notification (no id)
+			return d.decompileNotification(m, method.(string))
+		}
+	}
+
+	// Tool definition
+	if name, hasName := m["name"]; hasName {
+		if _, hasSchema := m["inputSchema"]; hasSchema {
+			return d.decompileTool(m, name.(string))
+		}
+		// Resource definition
+		if _, hasURI := m["uri"]; hasURI {
+			return d.decompileResource(m, name.(string), opts)
+		}
+		// Prompt definition
+		if _, hasMessages := m["messages"]; hasMessages {
+			return d.decompilePrompt(m, name.(string))
+		}
 	}
-	return nil
+
+	return ""
 }
 
-// compileRequest compiles a request node
-func (c *MCPDSLCompiler) compileRequest(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"method":  node.ReqMethod,
+// decompileBatch renders a JSON-RPC batch — a single []interface{} value
+// whose elements are all JSON-RPC messages — as a "[[ ... ]]" block, the
+// DSL form compileBatch's own "[[ ]]" construct compiles back into this
+// same shape. An empty slice, or one containing something that doesn't
+// decompile to a message on its own, isn't a batch of messages and falls
+// back to "" like any other unrecognized shape.
+func (d *MCPDSLDecompiler) decompileBatch(arr []interface{}, opts DecompileOptions) string {
+	if len(arr) == 0 {
+		return ""
 	}
 
-	if node.ReqID != nil {
-		result["id"] = *node.ReqID
+	rendered := make([]string, 0, len(arr))
+	for _, item := range arr {
+		line := d.DecompileWithOptions(item, opts)
+		if line == "" {
+			return ""
+		}
+		rendered = append(rendered, line)
 	}
 
-	if node.ReqParams != nil {
-		params := c.compileBlock(node.ReqParams)
+	return "[[\n  " + strings.Join(rendered, "\n  ") + "\n]]"
+}
 
-		// Create new params map with transformed keys
-		transformedParams := make(map[string]interface{})
+func (d *MCPDSLDecompiler) decompileRequest(m map[string]interface{}, method string) string {
+	id := d.formatID(m["id"])
+	result := "> " + method + "#" + id
 
-		for key, val := range params {
-			switch key {
-			case "v":
-				transformedParams["protocolVersion"] = val
-			case "caps":
-				transformedParams["capabilities"] = val
-			case "info":
-				if node.ReqMethod == "initialize" {
-					transformedParams["clientInfo"] = val
-				} else {
-					transformedParams["serverInfo"] = val
-				}
-			case "args":
-				transformedParams["arguments"] = val
-			default:
-				transformedParams[key] = val
-			}
-		}
+	if rendered, ok := d.decompileParamsOrValue(m["params"]); ok {
+		result += " " + rendered
+	}
 
-		result["params"] = transformedParams
+	return result
+}
+
+func (d *MCPDSLDecompiler) decompileResponse(m map[string]interface{}) string {
+	id := d.formatID(m["id"])
+	output := "< #" + id
+
+	if rendered, ok := d.decompileResultOrValue(m["result"]); ok {
+		output += " " + rendered
+	}
+
+	return output
+}
+
+func (d *MCPDSLDecompiler) decompileNotification(m map[string]interface{}, method string) string {
+	result := "! " + method
+
+	if rendered, ok := d.decompileParamsOrValue(m["params"]); ok {
+		result += " " + rendered
 	}
 
 	return result
 }
 
-// compileResponse compiles a response node
-func (c *MCPDSLCompiler) compileResponse(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      node.RespID,
+// decompileParamsOrValue renders a request/notification's "params" for
+// emission after its "#id"/method name. Per the JSON-RPC 2.0 spec params is
+// either an object (named params, go through decompileParams' field
+// remapping) or an array (positional params); anything else isn't spec-legal
+// but is still rendered via decompileValue rather than silently dropped, so
+// a round-tripped Compile(Parse(Decompile(x))) doesn't lose it. Reports
+// false for a nil or empty-object params, which the spec treats as "no
+// params" either way.
+func (d *MCPDSLDecompiler) decompileParamsOrValue(params interface{}) (string, bool) {
+	if params == nil {
+		return "", false
+	}
+	if _, isObj := asObject(params); isObj {
+		if len(objectKeys(params)) == 0 {
+			return "", false
+		}
+		return d.decompileParams(params), true
 	}
+	return d.decompileValue(params, 0), true
+}
 
-	if node.RespResult != nil {
-		resultData := c.compileBlock(node.RespResult)
+// decompileResultOrValue renders a response's "result" for emission after
+// its "#id". Per the JSON-RPC 2.0 spec a result can be any JSON value, not
+// just an object, so an array/string/number/bool result is rendered via
+// decompileValue instead of being silently dropped the way an empty-object
+// gate would. Reports false for a nil or empty-object result.
+func (d *MCPDSLDecompiler) decompileResultOrValue(result interface{}) (string, bool) {
+	if result == nil {
+		return "", false
+	}
+	if _, isObj := asObject(result); isObj {
+		if len(objectKeys(result)) == 0 {
+			return "", false
+		}
+		return d.decompileObject(result, 0), true
+	}
+	return d.decompileValue(result, 0), true
+}
 
-		// Create new result map with transformed keys
-		transformedResult := make(map[string]interface{})
+func (d *MCPDSLDecompiler) decompileError(m map[string]interface{}) string {
+	id := d.formatID(m["id"])
+	errorMap := d.getMapOrEmpty(m["error"])
 
-		for key, val := range resultData {
-			switch key {
-			case "v":
-				transformedResult["protocolVersion"] = val
-			case "caps":
-				transformedResult["capabilities"] = val
-			case "info":
-				transformedResult["serverInfo"] = val
-			case "ok":
-				if boolVal, ok := val.(bool); ok {
-					transformedResult["isError"] = !boolVal
-				}
-			default:
-				transformedResult[key] = val
+	code := d.formatValue(errorMap["code"])
+	message := d.formatValue(errorMap["message"])
+
+	return "x #" + id + " " + code + ":" + message
+}
+
+func (d *MCPDSLDecompiler) decompileTool(m map[string]interface{}, name string) string {
+	var result strings.Builder
+	result.WriteString("T ")
+	result.WriteString(name)
+	result.WriteString(" {\n")
+
+	if desc, ok := m["description"]; ok {
+		result.WriteString("  desc: ")
+		result.WriteString(d.formatValue(desc))
+		result.WriteString("\n")
+	}
+
+	if schema, ok := m["inputSchema"]; ok {
+		result.WriteString("  in: ")
+		result.WriteString(d.decompileSchema(schema, 2))
+		result.WriteString("\n")
+	}
+
+	if schema, ok := m["outputSchema"]; ok {
+		result.WriteString("  out: ")
+		result.WriteString(d.decompileSchema(schema, 2))
+		result.WriteString("\n")
+	}
+
+	// Handle annotations
+	if annotations, ok := asObject(m["annotations"]); ok {
+		if readOnly, ok := annotations["readOnlyHint"].(bool); ok && readOnly {
+			result.WriteString("  @readonly\n")
+		}
+		if idempotent, ok := annotations["idempotentHint"].(bool); ok && idempotent {
+			result.WriteString("  @idempotent\n")
+		}
+		if destructive, ok := annotations["destructiveHint"].(bool); ok && !destructive {
+			result.WriteString("  @destructive: false\n")
+		}
+		if openWorld, ok := annotations["openWorldHint"].(bool); ok && !openWorld {
+			result.WriteString("  @openWorld: false\n")
+		}
+	}
+
+	result.WriteString("}")
+	return result.String()
+}
+
+// resourceKnownFields are the JSON fields decompileResource renders through
+// dedicated DSL syntax (plus "name", carried on the "R <name>" line itself);
+// any other field is only preserved under Lossless, via an "extra" block.
+var resourceKnownFields = map[string]bool{
+	"name": true, "uri": true, "description": true, "mimeType": true,
+	"size": true, "annotations": true,
+}
+
+func (d *MCPDSLDecompiler) decompileResource(m map[string]interface{}, name string, opts DecompileOptions) string {
+	var result strings.Builder
+	result.WriteString("R ")
+	result.WriteString(name)
+	result.WriteString(" {\n")
+
+	if uri, ok := m["uri"]; ok {
+		result.WriteString("  uri: ")
+		result.WriteString(d.formatValue(uri))
+		result.WriteString("\n")
+	}
+
+	if desc, ok := m["description"]; ok {
+		result.WriteString("  desc: ")
+		result.WriteString(d.formatValue(desc))
+		result.WriteString("\n")
+	}
+
+	if mime, ok := m["mimeType"]; ok {
+		result.WriteString("  mime: ")
+		result.WriteString(d.formatValue(mime))
+		result.WriteString("\n")
+	}
+
+	if size, ok := m["size"]; ok {
+		result.WriteString("  size: ")
+		result.WriteString(d.formatValue(size))
+		result.WriteString("\n")
+	}
+
+	if annotations, ok := m["annotations"]; ok {
+		for _, key := range objectKeys(annotations) {
+			value, _ := fieldOf(annotations, key)
+			if boolVal, ok := value.(bool); ok && boolVal {
+				result.WriteString("  @")
+				result.WriteString(key)
+				result.WriteString("\n")
+			} else {
+				result.WriteString("  @")
+				result.WriteString(key)
+				result.WriteString(": ")
+				result.WriteString(d.formatValue(value))
+				result.WriteString("\n")
 			}
 		}
+	}
 
-		result["result"] = transformedResult
+	if opts.Lossless {
+		extra := make(map[string]interface{})
+		for key := range m {
+			if !resourceKnownFields[key] {
+				extra[key] = m[key]
+			}
+		}
+		if len(extra) > 0 {
+			result.WriteString("  extra: ")
+			result.WriteString(d.decompileObject(extra, 2))
+			result.WriteString("\n")
+		}
 	}
 
-	return result
+	result.WriteString("}")
+	return result.String()
 }
 
-// compileNotification compiles a notification node
-func (c *MCPDSLCompiler) compileNotification(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"method":  node.NotifMethod,
+func (d *MCPDSLDecompiler) decompilePrompt(m map[string]interface{}, name string) string {
+	var result strings.Builder
+	result.WriteString("P ")
+	result.WriteString(name)
+	result.WriteString(" {\n")
+
+	if desc, ok := m["description"]; ok {
+		result.WriteString("  desc: ")
+		result.WriteString(d.formatValue(desc))
+		result.WriteString("\n")
 	}
 
-	if node.NotifParams != nil {
-		result["params"] = c.compileBlock(node.NotifParams)
+	if args, ok := m["arguments"].([]interface{}); ok && len(args) > 0 {
+		result.WriteString("  args: {\n")
+		for _, arg := range args {
+			argMap, _ := asObject(arg)
+			argName := argMap["name"].(string)
+			required := ""
+			if req, ok := argMap["required"].(bool); ok && req {
+				required = "!"
+			}
+			result.WriteString("    ")
+			result.WriteString(argName)
+			result.WriteString(": str")
+			result.WriteString(required)
+			result.WriteString("\n")
+		}
+		result.WriteString("  }\n")
 	}
 
-	return result
+	if messages, ok := m["messages"].([]interface{}); ok && len(messages) > 0 {
+		result.WriteString("  msgs: [\n")
+		for _, msg := range messages {
+			msgMap, _ := asObject(msg)
+			role := "u"
+			if r, ok := msgMap["role"].(string); ok && r == "assistant" {
+				role = "a"
+			}
+			result.WriteString("    ")
+			result.WriteString(role)
+			result.WriteString(": ")
+			result.WriteString(d.decompileMessageContent(msgMap["content"]))
+			result.WriteString("\n")
+		}
+		result.WriteString("  ]\n")
+	}
+
+	result.WriteString("}")
+	return result.String()
 }
 
-// compileError compiles an error node
-func (c *MCPDSLCompiler) compileError(node *ASTNode) map[string]interface{} {
-	return map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      node.ErrID,
-		"error": map[string]interface{}{
-			"code":    node.ErrCode,
-			"message": node.ErrMessage,
-		},
+// decompileMessageContent renders one prompt message's "content" as DSL: a
+// plain string (or a {"type":"text"} part) as a bare escaped literal, same
+// as before typed content parts existed, and an image/audio/embedded-
+// resource part as "img:"/"audio:"/"res:" followed by its data/uri — so a
+// multimodal prompt message is at least visible in the decompiled DSL
+// instead of silently rendering as an empty string.
+func (d *MCPDSLDecompiler) decompileMessageContent(content interface{}) string {
+	if text, ok := content.(string); ok {
+		return escapeDSLString(text)
+	}
+
+	c, ok := asObject(content)
+	if !ok {
+		return escapeDSLString("")
+	}
+
+	switch c["type"] {
+	case "image":
+		return "img: " + escapeDSLString(d.contentDataOrURI(c))
+	case "audio":
+		return "audio: " + escapeDSLString(d.contentDataOrURI(c))
+	case "resource":
+		uri := ""
+		if resource, ok := asObject(c["resource"]); ok {
+			uri, _ = resource["uri"].(string)
+		}
+		return "res: " + escapeDSLString(uri)
 	}
+
+	if text, ok := c["text"].(string); ok {
+		return escapeDSLString(text)
+	}
+	return escapeDSLString("")
 }
 
-// compileTool compiles a tool definition
-func (c *MCPDSLCompiler) compileTool(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"name": node.DefName,
+// contentDataOrURI picks an image/audio content part's payload: a "uri"
+// pointing at external data if present, otherwise its inline base64 "data".
+func (d *MCPDSLDecompiler) contentDataOrURI(c map[string]interface{}) string {
+	if uri, ok := c["uri"].(string); ok {
+		return uri
 	}
+	data, _ := c["data"].(string)
+	return data
+}
 
-	if desc, ok := node.DefFields["desc"]; ok {
-		result["description"] = c.compileNode(desc)
+func (d *MCPDSLDecompiler) decompileParams(params interface{}) string {
+	obj := make(map[string]interface{})
+
+	// Reverse special field mappings
+	if protocolVersion, ok := fieldOf(params, "protocolVersion"); ok {
+		obj["v"] = protocolVersion
 	}
 
-	if inSchema, ok := node.DefFields["in"]; ok {
-		schema := c.compileSchema(inSchema)
-		result["inputSchema"] = schema
+	if capabilities, ok := fieldOf(params, "capabilities"); ok {
+		obj["caps"] = d.decompileCapabilities(capabilities)
 	}
 
-	return result
+	// Only clientInfo maps to the "info" DSL key (compileRequest only
+	// reverses it back to clientInfo/serverInfo based on method name, and
+	// serverInfo never legitimately appears in a request's params per the
+	// MCP spec). serverInfo, if present anyway, falls through to the
+	// generic passthrough below instead of colliding with clientInfo under
+	// the same "info" key.
+	if clientInfo, ok := fieldOf(params, "clientInfo"); ok {
+		obj["info"] = clientInfo
+	}
+
+	if arguments, ok := fieldOf(params, "arguments"); ok {
+		obj["args"] = arguments
+	}
+
+	// Copy other params
+	for _, key := range objectKeys(params) {
+		if key != "protocolVersion" && key != "capabilities" &&
+			key != "clientInfo" && key != "arguments" {
+			value, _ := fieldOf(params, key)
+			obj[key] = value
+		}
+	}
+
+	return d.decompileObject(obj, 0)
 }
 
-// compileResource compiles a resource definition
-func (c *MCPDSLCompiler) compileResource(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"name": node.DefName,
+func (d *MCPDSLDecompiler) decompileObject(obj interface{}, indent int) string {
+	keys := objectKeys(obj)
+	if len(keys) == 0 {
+		return "{}"
 	}
 
-	for key, value := range node.DefFields {
-		switch key {
-		case "uri":
-			result["uri"] = c.compileNode(value)
-		case "mime":
-			result["mimeType"] = c.compileNode(value)
-		case "desc":
-			result["description"] = c.compileNode(value)
+	var result strings.Builder
+	indentStr := strings.Repeat(" ", indent)
+	innerIndentStr := strings.Repeat(" ", indent+2)
+
+	result.WriteString("{\n")
+
+	for i, key := range keys {
+		value, _ := fieldOf(obj, key)
+		result.WriteString(innerIndentStr)
+		result.WriteString(key)
+		result.WriteString(": ")
+		result.WriteString(d.decompileValue(value, indent+2))
+		if i < len(keys)-1 {
+			result.WriteString(",")
 		}
+		result.WriteString("\n")
 	}
 
-	return result
+	result.WriteString(indentStr)
+	result.WriteString("}")
+
+	return result.String()
 }
 
-// compilePrompt compiles a prompt definition
-func (c *MCPDSLCompiler) compilePrompt(node *ASTNode) map[string]interface{} {
-	result := map[string]interface{}{
-		"name": node.DefName,
+func (d *MCPDSLDecompiler) decompileValue(value interface{}, indent int) string {
+	if value == nil {
+		return "null"
 	}
 
-	for key, value := range node.DefFields {
-		result[key] = c.compileNode(value)
+	switch v := value.(type) {
+	case string:
+		return escapeDSLString(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if v == float64(int(v)) {
+			return strconv.Itoa(int(v))
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]"
+		}
+		var items []string
+		for _, item := range v {
+			items = append(items, d.decompileValue(item, indent))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		return d.decompileObject(v, indent)
+	case *OrderedObject:
+		return d.decompileObject(v, indent)
 	}
 
-	return result
+	return ""
 }
 
-// compileBlock compiles a block node
-func (c *MCPDSLCompiler) compileBlock(node *ASTNode) map[string]interface{} {
-	result := make(map[string]interface{})
+func (d *MCPDSLDecompiler) decompileSchema(schema interface{}, indent int) string {
+	properties, ok := fieldOf(schema, "properties")
+	keys := objectKeys(properties)
+	if !ok || len(keys) == 0 {
+		return "{}"
+	}
 
-	for key, value := range node.BlockFields {
-		result[key] = c.compileNode(value)
+	var result strings.Builder
+	indentStr := strings.Repeat(" ", indent)
+	innerIndentStr := strings.Repeat(" ", indent+2)
+
+	result.WriteString("{\n")
+
+	required := schemaRequiredSet(schema)
+
+	for i, key := range keys {
+		value, _ := fieldOf(properties, key)
+		isRequired := required[key]
+
+		result.WriteString(innerIndentStr)
+		result.WriteString(key)
+		result.WriteString(": ")
+		result.WriteString(d.decompileType(value, isRequired, indent+2))
+		if i < len(keys)-1 {
+			result.WriteString(",")
+		}
+		result.WriteString("\n")
 	}
 
-	return result
+	result.WriteString(indentStr)
+	result.WriteString("}")
+
+	return result.String()
 }
 
-// compileSchema compiles a schema definition
-func (c *MCPDSLCompiler) compileSchema(node *ASTNode) map[string]interface{} {
-	if node.Kind != ASTBlock {
-		return nil
+// schemaRequiredSet reads a schema's "required" list into a lookup set, so a
+// nested object schema's own "required" list (not just the outermost one)
+// is honored wherever decompileSchema recurses.
+func schemaRequiredSet(schema interface{}) map[string]bool {
+	required := make(map[string]bool)
+	reqVal, ok := fieldOf(schema, "required")
+	if !ok {
+		return required
 	}
+	switch req := reqVal.(type) {
+	case []interface{}:
+		for _, r := range req {
+			if name, ok := r.(string); ok {
+				required[name] = true
+			}
+		}
+	case []string:
+		// compileSchema's own output carries "required" as []string rather
+		// than the []interface{} shape a decoded JSON document would use.
+		for _, name := range req {
+			required[name] = true
+		}
+	}
+	return required
+}
 
-	schema := map[string]interface{}{
-		"type":       "object",
-		"properties": make(map[string]interface{}),
+// schemaTypeNames maps a JSON Schema "type" value to its short DSL spelling,
+// the decompiler's counterpart to primitiveJSONTypes.
+var schemaTypeNames = map[string]string{
+	"string":  "str",
+	"integer": "int",
+	"number":  "num",
+	"boolean": "bool",
+}
+
+// decompileType renders one property's JSON Schema definition as schema
+// syntax (see parseSchema/compileSchemaNode, whose grammar this mirrors in
+// reverse): a nested "{ ... }" object (recursing into decompileSchema), an
+// array ("[T]"), an enum ("enum(a|b|c)"), a "oneOf"/"anyOf" union ("T|U"),
+// a "&Name" ref ("$ref"), or a primitive with its "(/pattern/)"/"(lo..hi)"
+// constraint suffix, if any.
+func (d *MCPDSLDecompiler) decompileType(typeDef interface{}, required bool, indent int) string {
+	suffix := ""
+	if required {
+		suffix = "!"
 	}
 
-	var required []string
+	if ref, ok := fieldOf(typeDef, "$ref"); ok {
+		if name, ok := ref.(string); ok {
+			return "&" + strings.TrimPrefix(name, "#/definitions/") + suffix
+		}
+	}
 
-	for key, value := range node.BlockFields {
-		// Check if value contains type info (e.g., "str!")
-		var fieldName string
-		var isRequired bool
-
-		if value.Kind == ASTValue {
-			typeStr, ok := value.Val.(string)
-			if ok {
-				fieldName = key
-				// Check if the type ends with ! (required)
-				if strings.HasSuffix(typeStr, "!") {
-					isRequired = true
-					typeStr = strings.TrimSuffix(typeStr, "!")
-				}
+	if oneOf, ok := fieldOf(typeDef, "oneOf"); ok {
+		return d.decompileUnion(oneOf, indent) + suffix
+	}
+	if anyOf, ok := fieldOf(typeDef, "anyOf"); ok {
+		return d.decompileUnion(anyOf, indent) + suffix
+	}
 
-				propSchema := make(map[string]interface{})
-				switch {
-				case strings.HasPrefix(typeStr, "str"):
-					propSchema["type"] = "string"
-				case strings.HasPrefix(typeStr, "int"):
-					propSchema["type"] = "integer"
-				case strings.HasPrefix(typeStr, "num"):
-					propSchema["type"] = "number"
-				case strings.HasPrefix(typeStr, "bool"):
-					propSchema["type"] = "boolean"
-				}
-				schema["properties"].(map[string]interface{})[fieldName] = propSchema
+	if enumVal, ok := fieldOf(typeDef, "enum"); ok {
+		if words, ok := enumWords(enumVal); ok {
+			return "enum(" + strings.Join(words, "|") + ")" + suffix
+		}
+	}
 
-				if isRequired {
-					required = append(required, fieldName)
-				}
+	typeStrVal, ok := fieldOf(typeDef, "type")
+	typeStr, _ := typeStrVal.(string)
+	if !ok || typeStr == "" {
+		return "str"
+	}
+
+	switch typeStr {
+	case "array":
+		// An array field's own "!" rides on its item type ("[str!]"), not
+		// after the closing bracket (see parseSchemaAtom's "[" case) — so
+		// `required` is threaded into the recursive call instead of
+		// appended as a suffix here.
+		itemType := "str"
+		if items, ok := fieldOf(typeDef, "items"); ok {
+			itemType = d.decompileType(items, required, indent)
+		} else if required {
+			itemType = "str!"
+		}
+		return "[" + itemType + "]"
+	case "object":
+		return d.decompileSchema(typeDef, indent)
+	}
+
+	dslType := schemaTypeNames[typeStr]
+	if dslType == "" {
+		dslType = typeStr
+	}
+
+	if pattern, ok := fieldOf(typeDef, "pattern"); ok {
+		if p, ok := pattern.(string); ok {
+			return dslType + "(/" + p + "/)" + suffix
+		}
+	}
+
+	minVal, hasMin := fieldOf(typeDef, "minimum")
+	maxVal, hasMax := fieldOf(typeDef, "maximum")
+	if hasMin || hasMax {
+		dslType += "(" + formatSchemaRange(toFloatPtr(minVal), toFloatPtr(maxVal)) + ")"
+	}
+
+	return dslType + suffix
+}
+
+// decompileUnion renders a JSON Schema "oneOf"/"anyOf" array as a "T|U"
+// union, compileSchemaNode's SchemaUnion case in reverse.
+func (d *MCPDSLDecompiler) decompileUnion(members interface{}, indent int) string {
+	items, ok := members.([]interface{})
+	if !ok || len(items) == 0 {
+		return "str"
+	}
+	parts := make([]string, len(items))
+	for i, member := range items {
+		parts[i] = d.decompileType(member, false, indent)
+	}
+	return strings.Join(parts, "|")
+}
+
+// enumWords converts a JSON Schema "enum" array into enum(a|b|c) words,
+// succeeding only when every value is a plain string — compileEnumType's
+// "enum(...)" grammar only accepts bare identifiers (see parseSchemaAtom),
+// so a numeric or mixed-type enum has no DSL spelling to round-trip through
+// and falls back to rendering the type without an enum.
+func enumWords(enumVal interface{}) ([]string, bool) {
+	items, ok := enumVal.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	words := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		words[i] = s
+	}
+	return words, true
+}
+
+// toFloatPtr converts a decoded JSON number (always float64 from
+// encoding/json, but occasionally int in hand-built test fixtures) into the
+// *float64 form formatSchemaRange expects, or nil if v isn't numeric.
+func toFloatPtr(v interface{}) *float64 {
+	switch n := v.(type) {
+	case float64:
+		return &n
+	case int:
+		f := float64(n)
+		return &f
+	}
+	return nil
+}
+
+// decompileCapabilities expands a "capabilities" object (possibly with
+// nested sub-capability objects) into a flat, sorted "key" /
+// "key.subKey" list, so the DSL output it feeds into decompileObject is
+// deterministic regardless of the input's own key order.
+func (d *MCPDSLDecompiler) decompileCapabilities(caps interface{}) map[string]interface{} {
+	capabilities := []string{}
+
+	for _, key := range objectKeys(caps) {
+		value, _ := fieldOf(caps, key)
+		if subKeys := objectKeys(value); len(subKeys) > 0 {
+			for _, subKey := range subKeys {
+				capabilities = append(capabilities, key+"."+subKey)
 			}
-		} else if value.Kind == ASTBlock {
-			// Nested object
-			fieldName = key
-			schema["properties"].(map[string]interface{})[fieldName] = c.compileSchema(value)
+		} else {
+			capabilities = append(capabilities, key)
 		}
 	}
 
-	if len(required) > 0 {
-		schema["required"] = required
+	sort.Strings(capabilities)
+
+	return map[string]interface{}{
+		"includes": capabilities,
 	}
+}
 
-	return schema
+func (d *MCPDSLDecompiler) formatID(id interface{}) string {
+	switch v := id.(type) {
+	case float64:
+		return strconv.Itoa(int(v))
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return ""
 }
 
-// ParseMCPDSL is the main entry point for parsing MCP-DSL
-func ParseMCPDSL(input string) interface{} {
-	lexer := NewMCPDSLLexer(input)
-	tokens := lexer.Tokenize()
+func (d *MCPDSLDecompiler) formatValue(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
 
-	parser := NewMCPDSLParser(tokens)
-	ast := parser.Parse()
+	switch v := value.(type) {
+	case string:
+		return escapeDSLString(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if v == float64(int(v)) {
+			return strconv.Itoa(int(v))
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
 
-	compiler := NewMCPDSLCompiler()
-	return compiler.Compile(ast)
+	return ""
+}
+
+func (d *MCPDSLDecompiler) getMapOrEmpty(value interface{}) map[string]interface{} {
+	if m, ok := asObject(value); ok {
+		return m
+	}
+	return make(map[string]interface{})
+}
+
+// DecompileMCPJSON is the main entry point for decompiling JSON to DSL
+func DecompileMCPJSON(data interface{}) string {
+	decompiler := NewMCPDSLDecompiler()
+	return decompiler.Decompile(data)
 }
 
 // ToJSON converts the result to a JSON string
@@ -918,4 +3947,3 @@ func ToJSON(v interface{}) (string, error) {
 	}
 	return string(bytes), nil
 }
-
@@ -0,0 +1,1034 @@
+// MCP-DSL value expressions — a small JMESPath subset
+//
+// A DSL value can be a "$..." expression instead of a literal, letting one
+// message reference and transform data produced by an earlier one, e.g.
+// args: $#1.result.items[?score > `0.8`].url. ParseExpr turns the raw text
+// captured by MCPDSLLexer.readExpression into an *Expr tree; EvalExpr walks
+// that tree against a MessageContext of already-compiled prior messages.
+//
+// Supported forms: `#N` (message reference), `@` (identity), backtick JSON
+// literals, `.name` (field), `[n]` (index), `[a:b:c]` (slice), `[]`
+// (flatten), `[?expr]` (filter, projecting over the kept elements),
+// `{a: x, b: y}` (multi-select hash), `[x, y]` (multi-select list), `|`
+// (pipe, which stops any projection in progress), and `&&`/`||`/`!` plus
+// `==`/`!=`/`<`/`<=`/`>`/`>=` comparators.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ExprKind identifies the operation an Expr node performs.
+type ExprKind int
+
+const (
+	ExprIdentity ExprKind = iota
+	ExprMessageRef
+	ExprLiteral
+	ExprField
+	ExprIndex
+	ExprSlice
+	ExprFlatten
+	ExprFilterProjection
+	ExprMultiSelectHash
+	ExprMultiSelectList
+	ExprPipe
+	ExprAnd
+	ExprOr
+	ExprNot
+	ExprCompare
+)
+
+// Expr is a node in a parsed value expression. As with ASTNode, one struct
+// covers every kind, with only the fields relevant to Kind populated.
+type Expr struct {
+	Kind ExprKind
+
+	// Left is the source expression for the chained/suffix kinds (Field,
+	// Index, Slice, Flatten, FilterProjection) and the left operand for
+	// Pipe/And/Or/Compare; it's also the operand for Not.
+	Left  *Expr
+	Right *Expr // Pipe/And/Or/Compare right-hand side
+
+	Name string // ExprField
+
+	IndexVal                         int  // ExprIndex
+	SliceStart, SliceStop, SliceStep *int // ExprSlice, any may be nil
+
+	Filter *Expr // ExprFilterProjection predicate, evaluated per element
+
+	Op string // ExprCompare: ==, !=, <, <=, >, >=
+
+	Literal interface{} // ExprLiteral
+
+	MessageID int // ExprMessageRef
+
+	Items  []*Expr          // ExprMultiSelectList
+	Fields map[string]*Expr // ExprMultiSelectHash
+
+	Line, Column int
+}
+
+// EvalError describes a failure evaluating an expression against a
+// MessageContext, with the source position of the offending token.
+type EvalError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e EvalError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// MessageContext maps a prior message's id (the "#N" in a request,
+// response, or error) to its already-compiled JSON-RPC value, so
+// expressions like $#1.result.url can look it up during compilation. It's
+// passed explicitly alongside typeRegistry rather than stored on the
+// compiler, keeping MCPDSLCompiler itself free of per-call state.
+type MessageContext map[int]interface{}
+
+// exprProjection marks a value produced by a projecting operation
+// (Flatten or FilterProjection) so that subsequent chained suffixes map
+// over each element instead of operating on the slice as a whole, per
+// JMESPath projection semantics. A Pipe realizes it back to a plain
+// []interface{} before the next stage.
+type exprProjection []interface{}
+
+// exprLexer tokenizes the raw text of a single "$..." expression.
+type exprLexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+}
+
+type exprTokenKind int
+
+const (
+	etEOF exprTokenKind = iota
+	etDot
+	etLBracket
+	etRBracket
+	etLBrace
+	etRBrace
+	etColon
+	etComma
+	etQuestion
+	etPipe
+	etAnd
+	etOr
+	etNot
+	etEq
+	etNeq
+	etLt
+	etLte
+	etGt
+	etGte
+	etHash
+	etAt
+	etIdent
+	etNumber
+	etLiteral
+)
+
+type exprToken struct {
+	kind   exprTokenKind
+	value  string
+	line   int
+	column int
+}
+
+func newExprLexer(src string, line, column int) *exprLexer {
+	return &exprLexer{src: src, line: line, column: column}
+}
+
+func (l *exprLexer) peekByte() byte {
+	if l.pos >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos]
+}
+
+func (l *exprLexer) advance() byte {
+	b := l.src[l.pos]
+	l.pos++
+	l.column++
+	return b
+}
+
+func (l *exprLexer) skipSpace() {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t') {
+		l.advance()
+	}
+}
+
+func (l *exprLexer) next() (exprToken, error) {
+	l.skipSpace()
+	if l.pos >= len(l.src) {
+		return exprToken{kind: etEOF, line: l.line, column: l.column}, nil
+	}
+
+	line, col := l.line, l.column
+	ch := l.peekByte()
+
+	switch ch {
+	case '.':
+		l.advance()
+		return exprToken{kind: etDot, line: line, column: col}, nil
+	case '[':
+		l.advance()
+		return exprToken{kind: etLBracket, line: line, column: col}, nil
+	case ']':
+		l.advance()
+		return exprToken{kind: etRBracket, line: line, column: col}, nil
+	case '{':
+		l.advance()
+		return exprToken{kind: etLBrace, line: line, column: col}, nil
+	case '}':
+		l.advance()
+		return exprToken{kind: etRBrace, line: line, column: col}, nil
+	case ':':
+		l.advance()
+		return exprToken{kind: etColon, line: line, column: col}, nil
+	case ',':
+		l.advance()
+		return exprToken{kind: etComma, line: line, column: col}, nil
+	case '?':
+		l.advance()
+		return exprToken{kind: etQuestion, line: line, column: col}, nil
+	case '#':
+		l.advance()
+		return exprToken{kind: etHash, line: line, column: col}, nil
+	case '@':
+		l.advance()
+		return exprToken{kind: etAt, line: line, column: col}, nil
+	case '!':
+		l.advance()
+		if l.peekByte() == '=' {
+			l.advance()
+			return exprToken{kind: etNeq, line: line, column: col}, nil
+		}
+		return exprToken{kind: etNot, line: line, column: col}, nil
+	case '=':
+		l.advance()
+		if l.peekByte() == '=' {
+			l.advance()
+			return exprToken{kind: etEq, line: line, column: col}, nil
+		}
+		return exprToken{}, EvalError{Line: line, Column: col, Message: "expected '==', found a single '='"}
+	case '<':
+		l.advance()
+		if l.peekByte() == '=' {
+			l.advance()
+			return exprToken{kind: etLte, line: line, column: col}, nil
+		}
+		return exprToken{kind: etLt, line: line, column: col}, nil
+	case '>':
+		l.advance()
+		if l.peekByte() == '=' {
+			l.advance()
+			return exprToken{kind: etGte, line: line, column: col}, nil
+		}
+		return exprToken{kind: etGt, line: line, column: col}, nil
+	case '&':
+		l.advance()
+		if l.peekByte() == '&' {
+			l.advance()
+			return exprToken{kind: etAnd, line: line, column: col}, nil
+		}
+		return exprToken{}, EvalError{Line: line, Column: col, Message: "expected '&&', found a single '&'"}
+	case '|':
+		l.advance()
+		if l.peekByte() == '|' {
+			l.advance()
+			return exprToken{kind: etOr, line: line, column: col}, nil
+		}
+		return exprToken{kind: etPipe, line: line, column: col}, nil
+	case '`':
+		return l.readLiteral()
+	}
+
+	if ch == '-' || (ch >= '0' && ch <= '9') {
+		return l.readNumber(), nil
+	}
+	if isIdentStart(ch) {
+		return l.readIdent(), nil
+	}
+
+	return exprToken{}, EvalError{Line: line, Column: col, Message: fmt.Sprintf("unexpected character %q in expression", ch)}
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentPart(ch byte) bool {
+	return isIdentStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+func (l *exprLexer) readIdent() exprToken {
+	line, col := l.line, l.column
+	start := l.pos
+	for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+		l.advance()
+	}
+	return exprToken{kind: etIdent, value: l.src[start:l.pos], line: line, column: col}
+}
+
+// readNumber reads an integer literal (index/slice bound or message id —
+// all of this subset's numeric positions are integers; fractional values
+// only ever appear inside backtick JSON literals).
+func (l *exprLexer) readNumber() exprToken {
+	line, col := l.line, l.column
+	start := l.pos
+	if l.peekByte() == '-' {
+		l.advance()
+	}
+	for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+		l.advance()
+	}
+	return exprToken{kind: etNumber, value: l.src[start:l.pos], line: line, column: col}
+}
+
+func (l *exprLexer) readLiteral() (exprToken, error) {
+	line, col := l.line, l.column
+	l.advance() // opening backtick
+	start := l.pos
+	for l.pos < len(l.src) && l.src[l.pos] != '`' {
+		l.advance()
+	}
+	if l.pos >= len(l.src) {
+		return exprToken{}, EvalError{Line: line, Column: col, Message: "unterminated backtick literal"}
+	}
+	raw := l.src[start:l.pos]
+	l.advance() // closing backtick
+	return exprToken{kind: etLiteral, value: raw, line: line, column: col}, nil
+}
+
+// exprParser is a small recursive-descent parser over exprLexer's tokens.
+type exprParser struct {
+	lex  *exprLexer
+	tok  exprToken
+	peek *exprToken
+	err  error
+}
+
+// ParseExpr parses the raw text of a "$..." value (without the leading
+// '$') into an Expr tree. line/column of the tokens are relative to the
+// start of the expression text itself, matching where the caller's
+// TokenExpression begins.
+func ParseExpr(src string) (*Expr, error) {
+	return parseExprAt(src, 1, 1)
+}
+
+func parseExprAt(src string, line, column int) (*Expr, error) {
+	p := &exprParser{lex: newExprLexer(src, line, column)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	expr, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != etEOF {
+		return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: fmt.Sprintf("unexpected trailing input at %q", p.tok.value)}
+	}
+	return expr, nil
+}
+
+func (p *exprParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *exprParser) parsePipe() (*Expr, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == etPipe {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expr{Kind: ExprPipe, Left: left, Right: right, Line: left.Line, Column: left.Column}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseOr() (*Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == etOr {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expr{Kind: ExprOr, Left: left, Right: right, Line: left.Line, Column: left.Column}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (*Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == etAnd {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &Expr{Kind: ExprAnd, Left: left, Right: right, Line: left.Line, Column: left.Column}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (*Expr, error) {
+	if p.tok.kind == etNot {
+		line, col := p.tok.line, p.tok.column
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprNot, Left: operand, Line: line, Column: col}, nil
+	}
+	return p.parseCompare()
+}
+
+var compareOps = map[exprTokenKind]string{
+	etEq: "==", etNeq: "!=", etLt: "<", etLte: "<=", etGt: ">", etGte: ">=",
+}
+
+func (p *exprParser) parseCompare() (*Expr, error) {
+	left, err := p.parseChain()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := compareOps[p.tok.kind]; ok {
+		line, col := p.tok.line, p.tok.column
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseChain()
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprCompare, Left: left, Right: right, Op: op, Line: line, Column: col}, nil
+	}
+	return left, nil
+}
+
+// parseChain parses a source expression (#N, @, a literal, a multi-select)
+// followed by zero or more ".field"/"[...]" suffixes.
+func (p *exprParser) parseChain() (*Expr, error) {
+	node, err := p.parseSource()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.tok.kind {
+		case etDot:
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != etIdent {
+				return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected a field name after '.'"}
+			}
+			field := &Expr{Kind: ExprField, Left: node, Name: p.tok.value, Line: p.tok.line, Column: p.tok.column}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			node = field
+		case etLBracket:
+			line, col := p.tok.line, p.tok.column
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			suffix, err := p.parseBracketSuffix(node, line, col)
+			if err != nil {
+				return nil, err
+			}
+			node = suffix
+		default:
+			return node, nil
+		}
+	}
+}
+
+// parseBracketSuffix parses the inside of "[...]" once the opening '[' has
+// already been consumed, given the already-parsed source node.
+func (p *exprParser) parseBracketSuffix(source *Expr, line, col int) (*Expr, error) {
+	switch p.tok.kind {
+	case etRBracket: // "[]" flatten
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprFlatten, Left: source, Line: line, Column: col}, nil
+	case etQuestion: // "[?expr]" filter projection
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		filter, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != etRBracket {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected ']' to close filter expression"}
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprFilterProjection, Left: source, Filter: filter, Line: line, Column: col}, nil
+	}
+
+	// "[n]" index or "[a:b:c]" slice.
+	var parts []*int
+	for {
+		if p.tok.kind == etColon || p.tok.kind == etRBracket {
+			parts = append(parts, nil)
+		} else if p.tok.kind == etNumber {
+			n, err := strconv.Atoi(p.tok.value)
+			if err != nil {
+				return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: fmt.Sprintf("invalid index %q", p.tok.value)}
+			}
+			parts = append(parts, &n)
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected an index, slice, or ']'/'?' inside '['"}
+		}
+
+		if p.tok.kind == etColon {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		break
+	}
+
+	if p.tok.kind != etRBracket {
+		return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected ']' to close index/slice"}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	if len(parts) == 1 {
+		if parts[0] == nil {
+			return nil, EvalError{Line: line, Column: col, Message: "expected an index inside '['"}
+		}
+		return &Expr{Kind: ExprIndex, Left: source, IndexVal: *parts[0], Line: line, Column: col}, nil
+	}
+
+	slice := &Expr{Kind: ExprSlice, Left: source, Line: line, Column: col}
+	if len(parts) > 0 {
+		slice.SliceStart = parts[0]
+	}
+	if len(parts) > 1 {
+		slice.SliceStop = parts[1]
+	}
+	if len(parts) > 2 {
+		slice.SliceStep = parts[2]
+	}
+	return slice, nil
+}
+
+// parseSource parses a primary expression: a message reference, identity,
+// literal, multi-select hash, or multi-select list.
+func (p *exprParser) parseSource() (*Expr, error) {
+	line, col := p.tok.line, p.tok.column
+
+	switch p.tok.kind {
+	case etHash:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != etNumber {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected a message number after '#'"}
+		}
+		n, err := strconv.Atoi(p.tok.value)
+		if err != nil {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: fmt.Sprintf("invalid message number %q", p.tok.value)}
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprMessageRef, MessageID: n, Line: line, Column: col}, nil
+	case etAt:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprIdentity, Line: line, Column: col}, nil
+	case etIdent:
+		// A bare identifier (e.g. the "score" in "score > `0.8`") is a
+		// field access against the current value, same as ".score" would
+		// be if it weren't the first thing in the chain.
+		name := p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprField, Left: &Expr{Kind: ExprIdentity, Line: line, Column: col}, Name: name, Line: line, Column: col}, nil
+	case etLiteral:
+		var lit interface{}
+		if err := json.Unmarshal([]byte(p.tok.value), &lit); err != nil {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: fmt.Sprintf("invalid JSON literal `%s`: %v", p.tok.value, err)}
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return &Expr{Kind: ExprLiteral, Literal: lit, Line: line, Column: col}, nil
+	case etLBrace:
+		return p.parseMultiSelectHash(line, col)
+	case etLBracket:
+		if err := p.advance(); err != nil { // '['
+			return nil, err
+		}
+		switch p.tok.kind {
+		case etRBracket, etQuestion, etNumber, etColon:
+			// A standalone bracket-specifier (e.g. the "[0]" right of a
+			// pipe) indexes/slices/filters the current value, same as a
+			// chained suffix would off an explicit source.
+			return p.parseBracketSuffix(&Expr{Kind: ExprIdentity, Line: line, Column: col}, line, col)
+		default:
+			return p.parseMultiSelectListBody(line, col)
+		}
+	}
+
+	return nil, EvalError{Line: line, Column: col, Message: fmt.Sprintf("expected an expression, found %q", p.tok.value)}
+}
+
+func (p *exprParser) parseMultiSelectHash(line, col int) (*Expr, error) {
+	if err := p.advance(); err != nil { // '{'
+		return nil, err
+	}
+	fields := make(map[string]*Expr)
+	for p.tok.kind != etRBrace {
+		if p.tok.kind != etIdent {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected a field name in multi-select hash"}
+		}
+		name := p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != etColon {
+			return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected ':' after multi-select hash key"}
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		val, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = val
+
+		if p.tok.kind == etComma {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		break
+	}
+	if p.tok.kind != etRBrace {
+		return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected '}' to close multi-select hash"}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return &Expr{Kind: ExprMultiSelectHash, Fields: fields, Line: line, Column: col}, nil
+}
+
+// parseMultiSelectListBody parses the inside of "[x, y]" once the opening
+// '[' has already been consumed.
+func (p *exprParser) parseMultiSelectListBody(line, col int) (*Expr, error) {
+	var items []*Expr
+	for p.tok.kind != etRBracket {
+		val, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, val)
+
+		if p.tok.kind == etComma {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		break
+	}
+	if p.tok.kind != etRBracket {
+		return nil, EvalError{Line: p.tok.line, Column: p.tok.column, Message: "expected ']' to close multi-select list"}
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return &Expr{Kind: ExprMultiSelectList, Items: items, Line: line, Column: col}, nil
+}
+
+// EvalExpr evaluates e against ctx and returns its result.
+func EvalExpr(e *Expr, ctx MessageContext) (interface{}, error) {
+	v, err := evalExpr(e, ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return realize(v), nil
+}
+
+func evalExpr(e *Expr, ctx MessageContext, value interface{}) (interface{}, error) {
+	switch e.Kind {
+	case ExprIdentity:
+		return value, nil
+	case ExprMessageRef:
+		v, ok := ctx[e.MessageID]
+		if !ok {
+			return nil, EvalError{Line: e.Line, Column: e.Column, Message: fmt.Sprintf("no prior message #%d in context", e.MessageID)}
+		}
+		return v, nil
+	case ExprLiteral:
+		return e.Literal, nil
+	case ExprMultiSelectList:
+		out := make([]interface{}, 0, len(e.Items))
+		for _, item := range e.Items {
+			v, err := evalExpr(item, ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case ExprMultiSelectHash:
+		out := make(map[string]interface{}, len(e.Fields))
+		for k, item := range e.Fields {
+			v, err := evalExpr(item, ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+	case ExprPipe:
+		left, err := evalExpr(e.Left, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		return evalExpr(e.Right, ctx, realize(left))
+	case ExprAnd:
+		left, err := evalExpr(e.Left, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		if !truthy(left) {
+			return left, nil
+		}
+		return evalExpr(e.Right, ctx, value)
+	case ExprOr:
+		left, err := evalExpr(e.Left, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(left) {
+			return left, nil
+		}
+		return evalExpr(e.Right, ctx, value)
+	case ExprNot:
+		left, err := evalExpr(e.Left, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(left), nil
+	case ExprCompare:
+		left, err := evalExpr(e.Left, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		right, err := evalExpr(e.Right, ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		return compareValues(e.Op, left, right), nil
+	}
+
+	// Remaining kinds (Field, Index, Slice, Flatten, FilterProjection)
+	// chain off Left; when Left produced a projection, map this suffix over
+	// each element instead of applying it once, per JMESPath semantics.
+	src, err := evalExpr(e.Left, ctx, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if proj, ok := src.(exprProjection); ok {
+		out := make(exprProjection, 0, len(proj))
+		for _, item := range proj {
+			v, err := applySuffix(e, ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue // projections drop nil results (type mismatch) silently
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	}
+
+	return applySuffix(e, ctx, src)
+}
+
+func applySuffix(e *Expr, ctx MessageContext, src interface{}) (interface{}, error) {
+	switch e.Kind {
+	case ExprField:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return m[e.Name], nil
+	case ExprIndex:
+		arr, ok := toSlice(src)
+		if !ok {
+			return nil, nil
+		}
+		idx := e.IndexVal
+		if idx < 0 {
+			idx += len(arr)
+		}
+		if idx < 0 || idx >= len(arr) {
+			return nil, nil
+		}
+		return arr[idx], nil
+	case ExprSlice:
+		arr, ok := toSlice(src)
+		if !ok {
+			return nil, nil
+		}
+		return sliceValue(arr, e.SliceStart, e.SliceStop, e.SliceStep), nil
+	case ExprFlatten:
+		arr, ok := toSlice(src)
+		if !ok {
+			return nil, nil
+		}
+		out := make([]interface{}, 0, len(arr))
+		for _, item := range arr {
+			if sub, ok := toSlice(item); ok {
+				out = append(out, sub...)
+			} else {
+				out = append(out, item)
+			}
+		}
+		return exprProjection(out), nil
+	case ExprFilterProjection:
+		arr, ok := toSlice(src)
+		if !ok {
+			return nil, nil
+		}
+		out := make([]interface{}, 0, len(arr))
+		for _, item := range arr {
+			keep, err := evalExpr(e.Filter, ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(keep) {
+				out = append(out, item)
+			}
+		}
+		return exprProjection(out), nil
+	}
+	return nil, nil
+}
+
+func toSlice(v interface{}) ([]interface{}, bool) {
+	switch t := v.(type) {
+	case []interface{}:
+		return t, true
+	case exprProjection:
+		return []interface{}(t), true
+	}
+	return nil, false
+}
+
+func sliceValue(arr []interface{}, start, stop, step *int) []interface{} {
+	n := len(arr)
+	stepVal := 1
+	if step != nil {
+		stepVal = *step
+	}
+	if stepVal == 0 {
+		return nil
+	}
+
+	var startVal, stopVal int
+	if stepVal > 0 {
+		startVal, stopVal = 0, n
+	} else {
+		startVal, stopVal = n-1, -1
+	}
+	if start != nil {
+		startVal = normalizeSliceIndex(*start, n)
+	}
+	if stop != nil {
+		stopVal = normalizeSliceIndex(*stop, n)
+	}
+
+	var out []interface{}
+	if stepVal > 0 {
+		for i := startVal; i < stopVal && i < n; i += stepVal {
+			if i >= 0 {
+				out = append(out, arr[i])
+			}
+		}
+	} else {
+		for i := startVal; i > stopVal && i >= 0; i += stepVal {
+			if i < n {
+				out = append(out, arr[i])
+			}
+		}
+	}
+	return out
+}
+
+func normalizeSliceIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) > 0
+	case exprProjection:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	default:
+		return true
+	}
+}
+
+func realize(v interface{}) interface{} {
+	if p, ok := v.(exprProjection); ok {
+		return []interface{}(p)
+	}
+	return v
+}
+
+// exprOrderedNumber coerces v to float64 for a compareValues comparison.
+// encoding/json decodes a JSON number as float64, but MCP-DSL's own
+// Compile emits a plain Go int for fields like a message id or error code
+// (see query/functions.go's orderedNumber, which needs this same
+// coercion), and a caller decoding with json.Decoder.UseNumber() produces
+// json.Number. Without this, $#1.id > `5` silently evaluates to false
+// against Compile's own output instead of comparing.
+func exprOrderedNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareValues implements JMESPath-style comparison: only defined between
+// two numbers, two strings, two bools (==/!= only), or against null;
+// anything else (including mismatched types) yields false.
+func compareValues(op string, left, right interface{}) bool {
+	if left == nil || right == nil {
+		switch op {
+		case "==":
+			return left == right
+		case "!=":
+			return left != right
+		}
+		return false
+	}
+	if ln, lok := exprOrderedNumber(left); lok {
+		if rn, rok := exprOrderedNumber(right); rok {
+			switch op {
+			case "==":
+				return ln == rn
+			case "!=":
+				return ln != rn
+			case "<":
+				return ln < rn
+			case "<=":
+				return ln <= rn
+			case ">":
+				return ln > rn
+			case ">=":
+				return ln >= rn
+			}
+		}
+		return false
+	}
+	if ls, lok := left.(string); lok {
+		if rs, rok := right.(string); rok {
+			switch op {
+			case "==":
+				return ls == rs
+			case "!=":
+				return ls != rs
+			case "<":
+				return ls < rs
+			case "<=":
+				return ls <= rs
+			case ">":
+				return ls > rs
+			case ">=":
+				return ls >= rs
+			}
+		}
+		return false
+	}
+	if lb, lok := left.(bool); lok {
+		if rb, rok := right.(bool); rok {
+			switch op {
+			case "==":
+				return lb == rb
+			case "!=":
+				return lb != rb
+			}
+		}
+		return false
+	}
+	return false
+}
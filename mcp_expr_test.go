@@ -0,0 +1,243 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExprFieldAndIndex(t *testing.T) {
+	ctx := MessageContext{
+		1: map[string]interface{}{"items": []interface{}{"a.com", "b.com", "c.com"}},
+	}
+
+	expr, err := ParseExpr("#1.items[1]")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	if got != "b.com" {
+		t.Errorf("expected b.com, got %v", got)
+	}
+}
+
+func TestParseExprSlice(t *testing.T) {
+	ctx := MessageContext{1: map[string]interface{}{"items": []interface{}{"a", "b", "c", "d"}}}
+
+	expr, err := ParseExpr("#1.items[1:3]")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	want := []interface{}{"b", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseExprFlatten(t *testing.T) {
+	ctx := MessageContext{
+		1: map[string]interface{}{"groups": []interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"c"},
+		}},
+	}
+
+	expr, err := ParseExpr("#1.groups[]")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	want := []interface{}{"a", "b", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseExprFilterProjection(t *testing.T) {
+	ctx := MessageContext{
+		1: map[string]interface{}{"items": []interface{}{
+			map[string]interface{}{"url": "a.com", "score": 0.9},
+			map[string]interface{}{"url": "b.com", "score": 0.2},
+			map[string]interface{}{"url": "c.com", "score": 0.95},
+		}},
+	}
+
+	expr, err := ParseExpr("#1.items[?score > `0.8`].url")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	want := []interface{}{"a.com", "c.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseExprPipeStopsProjection(t *testing.T) {
+	ctx := MessageContext{
+		1: map[string]interface{}{"items": []interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"c"},
+		}},
+	}
+
+	// Without the pipe, [0] would map over each flattened element instead
+	// of indexing the realized list once.
+	expr, err := ParseExpr("#1.items[] | [0]")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	if got != "a" {
+		t.Errorf("expected 'a', got %v", got)
+	}
+}
+
+func TestParseExprMultiSelectHashAndList(t *testing.T) {
+	ctx := MessageContext{1: map[string]interface{}{"name": "search", "ok": true}}
+
+	expr, err := ParseExpr("{n: #1.name, all: [#1.name, #1.ok]}")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	want := map[string]interface{}{
+		"n":   "search",
+		"all": []interface{}{"search", true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseExprBacktickLiteralAndComparators(t *testing.T) {
+	ctx := MessageContext{1: map[string]interface{}{"status": "ready"}}
+
+	expr, err := ParseExpr("#1.status == `\"ready\"`")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	if got != true {
+		t.Errorf("expected true, got %v", got)
+	}
+}
+
+func TestParseExprComparatorCoercesIntField(t *testing.T) {
+	// Compile emits a plain Go int for a message id, unlike an ordinary
+	// object-body number (which compiles to float64 via parsePrimaryValue,
+	// see TestParseExprFilterProjection's "score") - comparators must
+	// still work against it.
+	ctx := MessageContext{1: map[string]interface{}{"id": 7}}
+
+	expr, err := ParseExpr("#1.id > `5`")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	got, err := EvalExpr(expr, ctx)
+	if err != nil {
+		t.Fatalf("unexpected eval error: %v", err)
+	}
+	if got != true {
+		t.Errorf("expected true, got %v", got)
+	}
+}
+
+func TestParseExprMissingMessageIsEvalError(t *testing.T) {
+	expr, err := ParseExpr("#9.result")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if _, err := EvalExpr(expr, MessageContext{}); err == nil {
+		t.Fatalf("expected an eval error referencing an absent message, got none")
+	}
+}
+
+func TestParseExprMalformedReportsError(t *testing.T) {
+	if _, err := ParseExpr("#1.items[?score >"); err == nil {
+		t.Fatalf("expected a parse error for an unterminated filter expression")
+	}
+}
+
+func TestCompileExprWithoutContextEmitsPlaceholder(t *testing.T) {
+	dsl := `> tools/call#2 {name: "fetch", args: {urls: $#1.result.items[?score > ` + "`0.8`" + `].url}}`
+
+	result := ParseMCPDSL(dsl)
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a single compiled message, got %T", result)
+	}
+
+	params := m["params"].(map[string]interface{})
+	args := params["arguments"].(map[string]interface{})
+	urls, ok := args["urls"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a $ref placeholder for urls, got %v", args["urls"])
+	}
+	if urls["$ref"] != `#1.result.items[?score > `+"`0.8`"+`].url` {
+		t.Errorf("expected the placeholder to carry the original expression source, got %v", urls["$ref"])
+	}
+}
+
+func TestCompileWithContextEvaluatesExpression(t *testing.T) {
+	dsl := `< #1 {items: ["a.com", "b.com", "c.com"]}
+> tools/call#2 {name: "fetch", args: {url: $#1.result.items[0]}}`
+
+	lexer := NewMCPDSLLexer(dsl)
+	parser := NewMCPDSLParser(lexer.Tokenize())
+	nodes, errs := parser.Parse()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	compiler := NewMCPDSLCompiler()
+	result, evalErrs := compiler.CompileWithContext(nodes, MessageContext{})
+	if len(evalErrs) != 0 {
+		t.Fatalf("unexpected eval errors: %v", evalErrs)
+	}
+
+	messages := result.([]interface{})
+	call := messages[1].(map[string]interface{})
+	args := call["params"].(map[string]interface{})["arguments"].(map[string]interface{})
+	if args["url"] != "a.com" {
+		t.Errorf("expected url to resolve to a.com, got %v", args["url"])
+	}
+}
+
+func TestCompileWithContextRecordsEvalError(t *testing.T) {
+	dsl := `> tools/call#2 {name: "fetch", args: {url: $#1.result.items[0]}}`
+
+	result := ParseMCPDSL(dsl)
+	_ = result
+
+	lexer := NewMCPDSLLexer(dsl)
+	parser := NewMCPDSLParser(lexer.Tokenize())
+	nodes, _ := parser.Parse()
+
+	compiler := NewMCPDSLCompiler()
+	_, evalErrs := compiler.CompileWithContext(nodes, MessageContext{})
+	if len(evalErrs) != 1 {
+		t.Fatalf("expected 1 eval error for the unresolved #1 reference, got %v", evalErrs)
+	}
+}
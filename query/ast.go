@@ -0,0 +1,42 @@
+package query
+
+// nodeType identifies the kind of a query AST node.
+type nodeType int
+
+const (
+	nodeIdentity nodeType = iota
+	nodeCurrentNode
+	nodeField
+	nodeSubexpression
+	nodeIndexExpression
+	nodeSlice
+	nodeFlatten
+	nodeProjection // object (.*) or array ([*]) wildcard projection
+	nodeFilterProjection
+	nodeMultiSelectList
+	nodeMultiSelectHash
+	nodeOrExpression
+	nodeAndExpression
+	nodeNotExpression
+	nodePipe
+	nodeComparator
+	nodeFunctionExpression
+	nodeLiteral
+)
+
+// ASTNode is a node in the parsed query expression tree. value holds
+// node-specific data (a field name, comparator operator, literal value,
+// etc.) and children holds operand subtrees.
+type ASTNode struct {
+	nodeType nodeType
+	value    interface{}
+	children []ASTNode
+}
+
+// sliceParams holds the optional start/stop/step of a "[a:b:c]" slice;
+// a nil pointer means that component was omitted.
+type sliceParams struct {
+	start *int
+	stop  *int
+	step  *int
+}
@@ -0,0 +1,198 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// orderedNumber coerces v to float64 for an ordering comparison.
+// encoding/json decodes a JSON number as float64, but MCP-DSL's own
+// Compile emits a plain Go int for fields like a message id or error code
+// (see mcp_expr.go's compareValues, which needs this same coercion), and a
+// caller decoding with json.Decoder.UseNumber() produces json.Number.
+// Without this, "[?id > `5`]" silently evaluates to undefined against
+// Compile's own output instead of comparing.
+func orderedNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compare implements JMESPath's strict comparator rules: "==" and "!="
+// use deep equality across any types, while ordering comparators are only
+// defined for two numbers and evaluate to nil (undefined) otherwise. Two
+// values that both coerce via orderedNumber compare numerically for "=="/
+// "!=" too (e.g. Compile's int id against a `7` literal, which
+// reflect.DeepEqual would call unequal since one is int and the other
+// float64), falling back to DeepEqual for anything that isn't.
+func compare(op string, left, right interface{}) interface{} {
+	l, lok := orderedNumber(left)
+	r, rok := orderedNumber(right)
+
+	switch op {
+	case "==":
+		if lok && rok {
+			return l == r
+		}
+		return reflect.DeepEqual(left, right)
+	case "!=":
+		if lok && rok {
+			return l != r
+		}
+		return !reflect.DeepEqual(left, right)
+	}
+
+	if !lok || !rok {
+		return nil
+	}
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return nil
+}
+
+// callFunction dispatches a handful of commonly needed JMESPath builtins.
+func callFunction(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "length":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("query: length() takes 1 argument")
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		default:
+			return nil, fmt.Errorf("query: length() expects a string, array, or object")
+		}
+
+	case "keys":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("query: keys() takes 1 argument")
+		}
+		m, ok := args[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("query: keys() expects an object")
+		}
+		out := make([]interface{}, 0, len(m))
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out = append(out, k)
+		}
+		return out, nil
+
+	case "values":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("query: values() takes 1 argument")
+		}
+		m, ok := args[0].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("query: values() expects an object")
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]interface{}, 0, len(m))
+		for _, k := range keys {
+			out = append(out, m[k])
+		}
+		return out, nil
+
+	case "type":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("query: type() takes 1 argument")
+		}
+		return jmesType(args[0]), nil
+
+	case "contains":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("query: contains() takes 2 arguments")
+		}
+		switch haystack := args[0].(type) {
+		case []interface{}:
+			for _, el := range haystack {
+				if reflect.DeepEqual(el, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			needle, ok := args[1].(string)
+			if !ok {
+				return false, nil
+			}
+			return containsSubstring(haystack, needle), nil
+		default:
+			return false, nil
+		}
+
+	case "not_null":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("query: unknown function %q", name)
+	}
+}
+
+func jmesType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+func containsSubstring(s, substr string) bool {
+	if len(substr) == 0 {
+		return true
+	}
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+)
+
+// eval walks the AST against current, the "@" value at this point in the
+// expression. Projections (wildcard, flatten, filter) propagate nil
+// termination per element: if applying the projection's right-hand side
+// to an element yields nil, that element is dropped from the result
+// rather than included as a null.
+func eval(node ASTNode, current interface{}) (interface{}, error) {
+	switch node.nodeType {
+	case nodeIdentity, nodeCurrentNode:
+		return current, nil
+
+	case nodeLiteral:
+		return node.value, nil
+
+	case nodeField:
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return m[node.value.(string)], nil
+
+	case nodeSubexpression:
+		left, err := eval(node.children[0], current)
+		if err != nil || left == nil {
+			return nil, err
+		}
+		return eval(node.children[1], left)
+
+	case nodeIndexExpression:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		idx := node.value.(int)
+		if idx < 0 {
+			idx += len(arr)
+		}
+		if idx < 0 || idx >= len(arr) {
+			return nil, nil
+		}
+		return arr[idx], nil
+
+	case nodeSlice:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		return sliceArray(arr, node.value.(sliceParams)), nil
+
+	case nodeFlatten:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		var flat []interface{}
+		for _, el := range arr {
+			if sub, ok := el.([]interface{}); ok {
+				flat = append(flat, sub...)
+			} else {
+				flat = append(flat, el)
+			}
+		}
+		return projectOver(flat, node.children[1])
+
+	case nodeProjection:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		var elems []interface{}
+		switch node.value.(string) {
+		case "object":
+			m, ok := left.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				elems = append(elems, m[k])
+			}
+		case "array":
+			arr, ok := left.([]interface{})
+			if !ok {
+				return nil, nil
+			}
+			elems = arr
+		}
+		return projectOver(elems, node.children[1])
+
+	case nodeFilterProjection:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := left.([]interface{})
+		if !ok {
+			return nil, nil
+		}
+		var kept []interface{}
+		for _, el := range arr {
+			cond, err := eval(node.children[1], el)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(cond) {
+				kept = append(kept, el)
+			}
+		}
+		return projectOver(kept, node.children[2])
+
+	case nodeMultiSelectList:
+		if current == nil {
+			return nil, nil
+		}
+		results := make([]interface{}, len(node.children))
+		for i, c := range node.children {
+			v, err := eval(c, current)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = v
+		}
+		return results, nil
+
+	case nodeMultiSelectHash:
+		if current == nil {
+			return nil, nil
+		}
+		keys := node.value.([]string)
+		out := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			v, err := eval(node.children[i], current)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+
+	case nodeOrExpression:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(left) {
+			return left, nil
+		}
+		return eval(node.children[1], current)
+
+	case nodeAndExpression:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		if !truthy(left) {
+			return left, nil
+		}
+		return eval(node.children[1], current)
+
+	case nodeNotExpression:
+		operand, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy(operand), nil
+
+	case nodePipe:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		return eval(node.children[1], left)
+
+	case nodeComparator:
+		left, err := eval(node.children[0], current)
+		if err != nil {
+			return nil, err
+		}
+		right, err := eval(node.children[1], current)
+		if err != nil {
+			return nil, err
+		}
+		return compare(node.value.(string), left, right), nil
+
+	case nodeFunctionExpression:
+		args := make([]interface{}, len(node.children))
+		for i, c := range node.children {
+			v, err := eval(c, current)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return callFunction(node.value.(string), args)
+	}
+
+	return nil, fmt.Errorf("query: unhandled node type %d", node.nodeType)
+}
+
+// projectOver applies right to each element, dropping elements where it
+// evaluates to nil (JMESPath projection termination semantics).
+func projectOver(elems []interface{}, right ASTNode) (interface{}, error) {
+	var out []interface{}
+	for _, el := range elems {
+		v, err := eval(right, el)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func sliceArray(arr []interface{}, p sliceParams) []interface{} {
+	step := 1
+	if p.step != nil {
+		step = *p.step
+	}
+	if step == 0 {
+		return nil
+	}
+
+	n := len(arr)
+	start, stop := 0, n
+	if step < 0 {
+		start, stop = n-1, -n-1
+	}
+	if p.start != nil {
+		start = normalizeSliceIndex(*p.start, n)
+	}
+	if p.stop != nil {
+		stop = normalizeSliceIndex(*p.stop, n)
+	}
+
+	var out []interface{}
+	if step > 0 {
+		for i := start; i < stop && i < n; i += step {
+			if i >= 0 {
+				out = append(out, arr[i])
+			}
+		}
+	} else {
+		for i := start; i > stop && i >= 0; i += step {
+			if i < n {
+				out = append(out, arr[i])
+			}
+		}
+	}
+	return out
+}
+
+func normalizeSliceIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return i
+}
+
+// truthy implements JMESPath's definition of false: false, null, "", [],
+// and {} are falsy; every other value (including 0) is truthy.
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) != 0
+	case map[string]interface{}:
+		return len(t) != 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,257 @@
+// Package query implements a JMESPath-style expression language for
+// searching and projecting over the interface{} trees produced by
+// MCPDSLCompiler.Compile, so MCP tooling can introspect compiled
+// conversation transcripts without hand-rolling JSON traversal.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenType identifies a lexical token produced by the lexer.
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokDot
+	tokStar
+	tokLBracket
+	tokRBracket
+	tokFlatten // "[]"
+	tokFilter  // "[?"
+	tokLBrace
+	tokRBrace
+	tokComma
+	tokColon
+	tokPipe // "|"
+	tokOr   // "||"
+	tokAnd  // "&&"
+	tokNot  // "!"
+	tokEq   // "=="
+	tokNe   // "!="
+	tokLt
+	tokLte
+	tokGt
+	tokGte
+	tokAt // "@"
+	tokLParen
+	tokRParen
+	tokIdentifier
+	tokNumber
+	tokLiteral   // backtick-quoted JSON literal
+	tokRawString // single-quoted raw string literal
+)
+
+type token struct {
+	typ tokenType
+	val string
+}
+
+// lexer turns a JMESPath-subset expression into a stream of tokens.
+type lexer struct {
+	input string
+	pos   int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: input}
+}
+
+func (l *lexer) tokenize() ([]token, error) {
+	var tokens []token
+	for {
+		l.skipWhitespace()
+		if l.pos >= len(l.input) {
+			tokens = append(tokens, token{typ: tokEOF})
+			return tokens, nil
+		}
+
+		ch := l.input[l.pos]
+		switch {
+		case ch == '.':
+			tokens = append(tokens, token{typ: tokDot, val: "."})
+			l.pos++
+		case ch == '*':
+			tokens = append(tokens, token{typ: tokStar, val: "*"})
+			l.pos++
+		case ch == ',':
+			tokens = append(tokens, token{typ: tokComma, val: ","})
+			l.pos++
+		case ch == ':':
+			tokens = append(tokens, token{typ: tokColon, val: ":"})
+			l.pos++
+		case ch == '{':
+			tokens = append(tokens, token{typ: tokLBrace, val: "{"})
+			l.pos++
+		case ch == '}':
+			tokens = append(tokens, token{typ: tokRBrace, val: "}"})
+			l.pos++
+		case ch == '(':
+			tokens = append(tokens, token{typ: tokLParen, val: "("})
+			l.pos++
+		case ch == ')':
+			tokens = append(tokens, token{typ: tokRParen, val: ")"})
+			l.pos++
+		case ch == '@':
+			tokens = append(tokens, token{typ: tokAt, val: "@"})
+			l.pos++
+		case ch == '[':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == ']' {
+				tokens = append(tokens, token{typ: tokFlatten, val: "[]"})
+				l.pos += 2
+			} else if l.pos+1 < len(l.input) && l.input[l.pos+1] == '?' {
+				tokens = append(tokens, token{typ: tokFilter, val: "[?"})
+				l.pos += 2
+			} else {
+				tokens = append(tokens, token{typ: tokLBracket, val: "["})
+				l.pos++
+			}
+		case ch == ']':
+			tokens = append(tokens, token{typ: tokRBracket, val: "]"})
+			l.pos++
+		case ch == '|':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '|' {
+				tokens = append(tokens, token{typ: tokOr, val: "||"})
+				l.pos += 2
+			} else {
+				tokens = append(tokens, token{typ: tokPipe, val: "|"})
+				l.pos++
+			}
+		case ch == '&':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '&' {
+				tokens = append(tokens, token{typ: tokAnd, val: "&&"})
+				l.pos += 2
+			} else {
+				return nil, fmt.Errorf("query: unexpected '&' at position %d", l.pos)
+			}
+		case ch == '!':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+				tokens = append(tokens, token{typ: tokNe, val: "!="})
+				l.pos += 2
+			} else {
+				tokens = append(tokens, token{typ: tokNot, val: "!"})
+				l.pos++
+			}
+		case ch == '=':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+				tokens = append(tokens, token{typ: tokEq, val: "=="})
+				l.pos += 2
+			} else {
+				return nil, fmt.Errorf("query: unexpected '=' at position %d", l.pos)
+			}
+		case ch == '<':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+				tokens = append(tokens, token{typ: tokLte, val: "<="})
+				l.pos += 2
+			} else {
+				tokens = append(tokens, token{typ: tokLt, val: "<"})
+				l.pos++
+			}
+		case ch == '>':
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+				tokens = append(tokens, token{typ: tokGte, val: ">="})
+				l.pos += 2
+			} else {
+				tokens = append(tokens, token{typ: tokGt, val: ">"})
+				l.pos++
+			}
+		case ch == '"':
+			val, err := l.readQuoted('"')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{typ: tokIdentifier, val: val})
+		case ch == '\'':
+			val, err := l.readQuoted('\'')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{typ: tokRawString, val: val})
+		case ch == '`':
+			val, err := l.readBacktickLiteral()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{typ: tokLiteral, val: val})
+		case ch == '-' || unicode.IsDigit(rune(ch)):
+			tokens = append(tokens, l.readNumber())
+		case isIdentStart(ch):
+			tokens = append(tokens, l.readIdentifier())
+		default:
+			return nil, fmt.Errorf("query: unexpected character %q at position %d", ch, l.pos)
+		}
+	}
+}
+
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) {
+		l.pos++
+	}
+}
+
+func isIdentStart(ch byte) bool {
+	return unicode.IsLetter(rune(ch)) || ch == '_'
+}
+
+func isIdentPart(ch byte) bool {
+	return unicode.IsLetter(rune(ch)) || unicode.IsDigit(rune(ch)) || ch == '_'
+}
+
+func (l *lexer) readIdentifier() token {
+	start := l.pos
+	for l.pos < len(l.input) && isIdentPart(l.input[l.pos]) {
+		l.pos++
+	}
+	return token{typ: tokIdentifier, val: l.input[start:l.pos]}
+}
+
+func (l *lexer) readNumber() token {
+	start := l.pos
+	if l.input[l.pos] == '-' {
+		l.pos++
+	}
+	for l.pos < len(l.input) && unicode.IsDigit(rune(l.input[l.pos])) {
+		l.pos++
+	}
+	return token{typ: tokNumber, val: l.input[start:l.pos]}
+}
+
+func (l *lexer) readQuoted(quote byte) (string, error) {
+	l.pos++ // skip opening quote
+	var sb strings.Builder
+	for l.pos < len(l.input) && l.input[l.pos] != quote {
+		if l.input[l.pos] == '\\' && l.pos+1 < len(l.input) {
+			l.pos++
+			sb.WriteByte(l.input[l.pos])
+		} else {
+			sb.WriteByte(l.input[l.pos])
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return "", fmt.Errorf("query: unterminated quoted string")
+	}
+	l.pos++ // skip closing quote
+	return sb.String(), nil
+}
+
+func (l *lexer) readBacktickLiteral() (string, error) {
+	l.pos++ // skip opening backtick
+	var sb strings.Builder
+	for l.pos < len(l.input) && l.input[l.pos] != '`' {
+		if l.input[l.pos] == '\\' && l.pos+1 < len(l.input) && l.input[l.pos+1] == '`' {
+			sb.WriteByte('`')
+			l.pos += 2
+			continue
+		}
+		sb.WriteByte(l.input[l.pos])
+		l.pos++
+	}
+	if l.pos >= len(l.input) {
+		return "", fmt.Errorf("query: unterminated literal")
+	}
+	l.pos++ // skip closing backtick
+	return sb.String(), nil
+}
@@ -0,0 +1,425 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// parser is a Pratt-style parser: precedence climbs through
+// or -> and -> not -> comparator -> pipe -> postfix chain, and chain
+// parsing itself hands projection nodes (Flatten, wildcard Projection,
+// FilterProjection) the remainder of the expression as their right-hand
+// operand, since later steps apply per projected element rather than to
+// the projection's result as a whole.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parseExpression(expr string) (ASTNode, error) {
+	tokens, err := newLexer(expr).tokenize()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	if p.peek().typ != tokEOF {
+		return ASTNode{}, fmt.Errorf("query: unexpected token %q", p.peek().val)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (ASTNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	for p.peek().typ == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		left = ASTNode{nodeType: nodeOrExpression, children: []ASTNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (ASTNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	for p.peek().typ == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		left = ASTNode{nodeType: nodeAndExpression, children: []ASTNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (ASTNode, error) {
+	if p.peek().typ == tokNot {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		return ASTNode{nodeType: nodeNotExpression, children: []ASTNode{operand}}, nil
+	}
+	return p.parseComparator()
+}
+
+var comparatorTokens = map[tokenType]string{
+	tokEq: "==", tokNe: "!=", tokLt: "<", tokLte: "<=", tokGt: ">", tokGte: ">=",
+}
+
+func (p *parser) parseComparator() (ASTNode, error) {
+	left, err := p.parsePipe()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	if op, ok := comparatorTokens[p.peek().typ]; ok {
+		p.next()
+		right, err := p.parsePipe()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		return ASTNode{nodeType: nodeComparator, value: op, children: []ASTNode{left, right}}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parsePipe() (ASTNode, error) {
+	left, err := p.parseChain()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	for p.peek().typ == tokPipe {
+		p.next()
+		right, err := p.parseChain()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		left = ASTNode{nodeType: nodePipe, children: []ASTNode{left, right}}
+	}
+	return left, nil
+}
+
+// atChainEnd reports whether the current token cannot start (or continue) a
+// postfix chain, i.e. parsePrimary should fall back to an implicit Identity.
+func (p *parser) atChainEnd() bool {
+	switch p.peek().typ {
+	case tokEOF, tokPipe, tokOr, tokAnd, tokEq, tokNe, tokLt, tokLte, tokGt, tokGte,
+		tokRBracket, tokRBrace, tokRParen, tokComma, tokColon:
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseChain() (ASTNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	return p.parseChainTail(node)
+}
+
+// parseChainTail consumes any trailing '.', '[...]', '[]', or '[?...]'
+// operators applied to node. It is also used to parse the remainder of a
+// chain after a projection-starting token, where the remainder may itself
+// begin with '.' or '[' rather than a primary expression.
+func (p *parser) parseChainTail(node ASTNode) (ASTNode, error) {
+	for {
+		switch p.peek().typ {
+		case tokDot:
+			p.next()
+			if p.peek().typ == tokStar {
+				p.next()
+				right, err := p.parseChainTail(ASTNode{nodeType: nodeIdentity})
+				if err != nil {
+					return ASTNode{}, err
+				}
+				return ASTNode{nodeType: nodeProjection, value: "object", children: []ASTNode{node, right}}, nil
+			}
+			rhs, err := p.parsePrimary()
+			if err != nil {
+				return ASTNode{}, err
+			}
+			node = ASTNode{nodeType: nodeSubexpression, children: []ASTNode{node, rhs}}
+		case tokLBracket:
+			var err error
+			var absorbed bool
+			node, absorbed, err = p.parseBracket(node)
+			if err != nil {
+				return ASTNode{}, err
+			}
+			if absorbed {
+				return node, nil
+			}
+		case tokFlatten:
+			p.next()
+			right, err := p.parseChainTail(ASTNode{nodeType: nodeIdentity})
+			if err != nil {
+				return ASTNode{}, err
+			}
+			return ASTNode{nodeType: nodeFlatten, children: []ASTNode{node, right}}, nil
+		case tokFilter:
+			filtered, err := p.parseFilter(node)
+			if err != nil {
+				return ASTNode{}, err
+			}
+			return filtered, nil
+		default:
+			return node, nil
+		}
+	}
+}
+
+// parseBracket parses "[N]", "[a:b:c]" or "[*]" applied postfix to left.
+// The second return value reports whether the resulting node absorbed the
+// rest of the chain (true for the "[*]" projection case).
+func (p *parser) parseBracket(left ASTNode) (ASTNode, bool, error) {
+	p.next() // consume '['
+
+	if p.peek().typ == tokStar {
+		p.next()
+		if p.peek().typ != tokRBracket {
+			return ASTNode{}, false, fmt.Errorf("query: expected ']' after '[*'")
+		}
+		p.next()
+		right, err := p.parseChainTail(ASTNode{nodeType: nodeIdentity})
+		if err != nil {
+			return ASTNode{}, false, err
+		}
+		return ASTNode{nodeType: nodeProjection, value: "array", children: []ASTNode{left, right}}, true, nil
+	}
+
+	// Either "[N]" (index) or "[a:b:c]" (slice).
+	var start, stop, step *int
+	sawColon := false
+
+	if n, ok, err := p.tryParseSignedInt(); err != nil {
+		return ASTNode{}, false, err
+	} else if ok {
+		start = &n
+	}
+
+	if p.peek().typ == tokColon {
+		sawColon = true
+		p.next()
+		if n, ok, err := p.tryParseSignedInt(); err != nil {
+			return ASTNode{}, false, err
+		} else if ok {
+			stop = &n
+		}
+		if p.peek().typ == tokColon {
+			p.next()
+			if n, ok, err := p.tryParseSignedInt(); err != nil {
+				return ASTNode{}, false, err
+			} else if ok {
+				step = &n
+			}
+		}
+	}
+
+	if p.peek().typ != tokRBracket {
+		return ASTNode{}, false, fmt.Errorf("query: expected ']', got %q", p.peek().val)
+	}
+	p.next()
+
+	if sawColon {
+		return ASTNode{nodeType: nodeSlice, value: sliceParams{start, stop, step}, children: []ASTNode{left}}, false, nil
+	}
+	if start == nil {
+		return ASTNode{}, false, fmt.Errorf("query: empty index expression")
+	}
+	return ASTNode{nodeType: nodeIndexExpression, value: *start, children: []ASTNode{left}}, false, nil
+}
+
+func (p *parser) tryParseSignedInt() (int, bool, error) {
+	if p.peek().typ != tokNumber {
+		return 0, false, nil
+	}
+	tok := p.next()
+	var n int
+	if _, err := fmt.Sscanf(tok.val, "%d", &n); err != nil {
+		return 0, false, fmt.Errorf("query: invalid integer %q", tok.val)
+	}
+	return n, true, nil
+}
+
+// parseFilter parses "[?cond]" applied to left, then absorbs the remainder
+// of the chain as the per-element projection.
+func (p *parser) parseFilter(left ASTNode) (ASTNode, error) {
+	p.next() // consume '[?'
+	cond, err := p.parseOr()
+	if err != nil {
+		return ASTNode{}, err
+	}
+	if p.peek().typ != tokRBracket {
+		return ASTNode{}, fmt.Errorf("query: expected ']' to close filter expression")
+	}
+	p.next()
+	right, err := p.parseChainTail(ASTNode{nodeType: nodeIdentity})
+	if err != nil {
+		return ASTNode{}, err
+	}
+	return ASTNode{nodeType: nodeFilterProjection, children: []ASTNode{left, cond, right}}, nil
+}
+
+func (p *parser) parsePrimary() (ASTNode, error) {
+	tok := p.peek()
+	switch tok.typ {
+	case tokAt:
+		p.next()
+		return ASTNode{nodeType: nodeCurrentNode}, nil
+	case tokIdentifier:
+		p.next()
+		if p.peek().typ == tokLParen {
+			return p.parseFunctionCall(tok.val)
+		}
+		return ASTNode{nodeType: nodeField, value: tok.val}, nil
+	case tokLiteral:
+		p.next()
+		var v interface{}
+		if err := json.Unmarshal([]byte(tok.val), &v); err != nil {
+			return ASTNode{}, fmt.Errorf("query: invalid literal `%s`: %w", tok.val, err)
+		}
+		return ASTNode{nodeType: nodeLiteral, value: v}, nil
+	case tokRawString:
+		p.next()
+		return ASTNode{nodeType: nodeLiteral, value: tok.val}, nil
+	case tokLBracket:
+		// "[0]"/"[a:b]" index/slice the current node; anything else
+		// ("[a, b]") is a multi-select list.
+		if next := p.tokens[p.pos+1]; next.typ == tokNumber || next.typ == tokColon {
+			node, _, err := p.parseBracket(ASTNode{nodeType: nodeIdentity})
+			return node, err
+		}
+		return p.parseMultiSelectList()
+	case tokLBrace:
+		return p.parseMultiSelectHash()
+	case tokFilter:
+		// A leading "[?cond]" filters the current node.
+		return p.parseFilter(ASTNode{nodeType: nodeIdentity})
+	case tokFlatten:
+		// A leading "[]" flattens the current node.
+		p.next()
+		right, err := p.parseChainTail(ASTNode{nodeType: nodeIdentity})
+		if err != nil {
+			return ASTNode{}, err
+		}
+		return ASTNode{nodeType: nodeFlatten, children: []ASTNode{{nodeType: nodeIdentity}, right}}, nil
+	case tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		if p.peek().typ != tokRParen {
+			return ASTNode{}, fmt.Errorf("query: expected ')'")
+		}
+		p.next()
+		return node, nil
+	default:
+		if p.atChainEnd() {
+			return ASTNode{nodeType: nodeIdentity}, nil
+		}
+		return ASTNode{}, fmt.Errorf("query: unexpected token %q", tok.val)
+	}
+}
+
+func (p *parser) parseFunctionCall(name string) (ASTNode, error) {
+	p.next() // consume '('
+	var args []ASTNode
+	for p.peek().typ != tokRParen {
+		arg, err := p.parseOr()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		args = append(args, arg)
+		if p.peek().typ == tokComma {
+			p.next()
+			continue
+		}
+		break
+	}
+	if p.peek().typ != tokRParen {
+		return ASTNode{}, fmt.Errorf("query: expected ')' to close call to %s", name)
+	}
+	p.next()
+	return ASTNode{nodeType: nodeFunctionExpression, value: name, children: args}, nil
+}
+
+func (p *parser) parseMultiSelectList() (ASTNode, error) {
+	p.next() // consume '['
+	var elems []ASTNode
+	for p.peek().typ != tokRBracket {
+		elem, err := p.parseOr()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		elems = append(elems, elem)
+		if p.peek().typ == tokComma {
+			p.next()
+			continue
+		}
+		break
+	}
+	if p.peek().typ != tokRBracket {
+		return ASTNode{}, fmt.Errorf("query: expected ']' to close multi-select list")
+	}
+	p.next()
+	return ASTNode{nodeType: nodeMultiSelectList, children: elems}, nil
+}
+
+func (p *parser) parseMultiSelectHash() (ASTNode, error) {
+	p.next() // consume '{'
+	var keys []string
+	var vals []ASTNode
+	for p.peek().typ != tokRBrace {
+		keyTok := p.next()
+		if keyTok.typ != tokIdentifier {
+			return ASTNode{}, fmt.Errorf("query: expected key in multi-select hash, got %q", keyTok.val)
+		}
+		if p.peek().typ != tokColon {
+			return ASTNode{}, fmt.Errorf("query: expected ':' after hash key %q", keyTok.val)
+		}
+		p.next()
+		val, err := p.parseOr()
+		if err != nil {
+			return ASTNode{}, err
+		}
+		keys = append(keys, keyTok.val)
+		vals = append(vals, val)
+		if p.peek().typ == tokComma {
+			p.next()
+			continue
+		}
+		break
+	}
+	if p.peek().typ != tokRBrace {
+		return ASTNode{}, fmt.Errorf("query: expected '}' to close multi-select hash")
+	}
+	p.next()
+	return ASTNode{nodeType: nodeMultiSelectHash, value: keys, children: vals}, nil
+}
@@ -0,0 +1,14 @@
+package query
+
+// Search evaluates a JMESPath-style expression against data (typically the
+// interface{} tree returned by MCPDSLCompiler.Compile) and returns the
+// result, e.g.:
+//
+//	query.Search(`[?method=='tools/call'].params.name`, compiled)
+func Search(expression string, data interface{}) (interface{}, error) {
+	node, err := parseExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	return eval(node, data)
+}
@@ -0,0 +1,183 @@
+package query
+
+import "testing"
+
+func TestSearchField(t *testing.T) {
+	data := map[string]interface{}{"method": "tools/call"}
+	result, err := Search("method", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "tools/call" {
+		t.Errorf("Expected 'tools/call', got %v", result)
+	}
+}
+
+func TestSearchSubexpression(t *testing.T) {
+	data := map[string]interface{}{
+		"params": map[string]interface{}{
+			"name": "search",
+		},
+	}
+	result, err := Search("params.name", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "search" {
+		t.Errorf("Expected 'search', got %v", result)
+	}
+}
+
+func TestSearchFilterProjection(t *testing.T) {
+	data := []interface{}{
+		map[string]interface{}{"method": "tools/call", "params": map[string]interface{}{"name": "search"}},
+		map[string]interface{}{"method": "ping"},
+		map[string]interface{}{"method": "tools/call", "params": map[string]interface{}{"name": "fetch"}},
+	}
+
+	result, err := Search(`[?method=='tools/call'].params.name`, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names, ok := result.([]interface{})
+	if !ok {
+		t.Fatalf("Expected a slice, got %T", result)
+	}
+	if len(names) != 2 || names[0] != "search" || names[1] != "fetch" {
+		t.Errorf("Expected [search, fetch], got %v", names)
+	}
+}
+
+func TestSearchFlattenDropsNilProjectionResults(t *testing.T) {
+	data := map[string]interface{}{
+		"batches": []interface{}{
+			[]interface{}{
+				map[string]interface{}{"id": 1.0},
+				map[string]interface{}{},
+			},
+			[]interface{}{
+				map[string]interface{}{"id": 2.0},
+			},
+		},
+	}
+
+	result, err := Search("batches[].id", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids, ok := result.([]interface{})
+	if !ok {
+		t.Fatalf("Expected a slice, got %T", result)
+	}
+	if len(ids) != 2 || ids[0] != 1.0 || ids[1] != 2.0 {
+		t.Errorf("Expected [1, 2] (nil entries dropped), got %v", ids)
+	}
+}
+
+func TestSearchIndexAndSlice(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{"a", "b", "c", "d"},
+	}
+
+	if result, err := Search("items[1]", data); err != nil || result != "b" {
+		t.Errorf("Expected 'b', got %v (err=%v)", result, err)
+	}
+
+	result, err := Search("items[1:3]", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	slice, ok := result.([]interface{})
+	if !ok || len(slice) != 2 || slice[0] != "b" || slice[1] != "c" {
+		t.Errorf("Expected [b, c], got %v", result)
+	}
+}
+
+func TestSearchComparators(t *testing.T) {
+	data := []interface{}{
+		map[string]interface{}{"score": 0.9},
+		map[string]interface{}{"score": 0.5},
+	}
+
+	result, err := Search("[?score > `0.8`]", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matched, ok := result.([]interface{})
+	if !ok || len(matched) != 1 {
+		t.Fatalf("Expected 1 match, got %v", result)
+	}
+}
+
+func TestSearchComparatorsCoerceIntFields(t *testing.T) {
+	// Compile emits a plain Go int for fields like a message id, unlike an
+	// ordinary object-body number (which compiles to float64 via
+	// parsePrimaryValue, see TestSearchComparators) - ordering must still
+	// work against it.
+	data := []interface{}{
+		map[string]interface{}{"id": 7},
+		map[string]interface{}{"id": 3},
+	}
+
+	result, err := Search("[?id > `5`]", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matched, ok := result.([]interface{})
+	if !ok || len(matched) != 1 {
+		t.Fatalf("Expected 1 match, got %v", result)
+	}
+
+	result, err = Search("[?id == `7`]", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	matched, ok = result.([]interface{})
+	if !ok || len(matched) != 1 {
+		t.Fatalf("Expected 1 match, got %v", result)
+	}
+}
+
+func TestSearchMultiSelectHash(t *testing.T) {
+	data := map[string]interface{}{"method": "ping", "id": 1.0}
+	result, err := Search("{m: method, i: id}", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a map, got %T", result)
+	}
+	if m["m"] != "ping" || m["i"] != 1.0 {
+		t.Errorf("Unexpected result: %v", m)
+	}
+}
+
+func TestSearchPipeResetsProjection(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": 1.0},
+			map[string]interface{}{"id": 2.0},
+		},
+	}
+	result, err := Search("items[*].id | [0]", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != 1.0 {
+		t.Errorf("Expected 1, got %v", result)
+	}
+}
+
+func TestSearchFunctionCalls(t *testing.T) {
+	data := map[string]interface{}{"items": []interface{}{"a", "b", "c"}}
+	result, err := Search("length(items)", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != float64(3) {
+		t.Errorf("Expected 3, got %v", result)
+	}
+}
@@ -0,0 +1,16 @@
+package session
+
+// Client is an MCP session used from the side that dials a connection. Its
+// Call/Notify/Handle methods are shared with Server (see session.go):
+// MCP-DSL connections are bidirectional, so a Client answers inbound
+// requests/notifications the same way a Server does.
+type Client struct {
+	*session
+}
+
+// NewClient starts a Client reading from and writing to transport. The
+// returned Client begins servicing inbound messages immediately in the
+// background; call Close to stop.
+func NewClient(transport Transport) *Client {
+	return &Client{session: newSession(transport)}
+}
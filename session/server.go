@@ -0,0 +1,16 @@
+package session
+
+// Server is an MCP session used from the side that accepted a connection.
+// It exposes the identical Call/Notify/Handle surface as Client — the two
+// types only differ in which end of the connection constructed them, since
+// either peer can initiate a call over MCP-DSL's bidirectional transport.
+type Server struct {
+	*session
+}
+
+// NewServer starts a Server reading from and writing to transport. The
+// returned Server begins servicing inbound messages immediately in the
+// background; call Close to stop.
+func NewServer(transport Transport) *Server {
+	return &Server{session: newSession(transport)}
+}
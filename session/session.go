@@ -0,0 +1,347 @@
+// Package session layers a full MCP client/server runtime on top of an
+// MCP-DSL transport: it auto-generates request IDs, correlates "<"/"x"
+// responses back to the "Call" that sent them, routes "!" notifications
+// (and unanswered requests) to registered handlers, and honors per-call
+// context.Context cancellation.
+//
+// This package cannot import the root package's ParseMCPDSL/DecompileMCPJSON
+// or StreamDecoder/StreamEncoder directly: they live in `package main`,
+// and Go refuses to import a program as a library ("import ... is a
+// program, not an importable package"). Instead a session talks to its
+// peer through the small Transport interface below, which callers satisfy
+// with their own thin adapter around the root package's streaming types,
+// e.g.:
+//
+//	type dslTransport struct {
+//		enc *mainpkg.StreamEncoder
+//		dec *mainpkg.StreamDecoder
+//	}
+//	func (t dslTransport) Encode(msg interface{}) error { return t.enc.Encode(msg) }
+//	func (t dslTransport) Decode() (interface{}, error)  { return t.dec.Next() }
+//
+// For the same reason, Transcript can't call DecompileMCPJSON itself to
+// render a human-readable line — so it doesn't try to: TranscriptRender is a
+// caller-supplied func(interface{}) string, and a caller that can import the
+// root package passes mainpkg.DecompileMCPJSON directly to get an actual DSL
+// transcript. Left nil, Transcript falls back to compact JSON, which is what
+// this package can render on its own.
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Transport is the minimal contract a session needs from its wire framing:
+// encode one outbound JSON-RPC message (the same map[string]interface{}
+// shape MCPDSLCompiler.Compile produces) and decode one inbound one.
+type Transport interface {
+	Encode(msg interface{}) error
+	Decode() (interface{}, error)
+}
+
+// HandlerFunc handles one inbound request or notification registered via
+// Handle. For a request (the peer is waiting on a response), the returned
+// result or error is sent back as a "<"/"x" message; for a notification,
+// the return value is ignored.
+type HandlerFunc func(ctx context.Context, params interface{}) (result interface{}, err error)
+
+type pendingCall struct {
+	resultCh chan interface{}
+	errCh    chan error
+}
+
+// session is the shared bidirectional runtime behind both Client and
+// Server: an MCP-DSL connection is bidirectional, so either end can issue
+// calls/notifications and both must answer whatever the other side sends.
+type session struct {
+	transport Transport
+
+	// Transcript, if set, receives one rendered line for every message sent
+	// or received. Each line is produced by TranscriptRender if set, or by
+	// compact JSON encoding otherwise (see the package doc for why DSL
+	// rendering isn't this package's own default).
+	Transcript io.Writer
+	// TranscriptRender renders one message for Transcript, e.g. the root
+	// package's DecompileMCPJSON for a human-readable DSL transcript. Nil
+	// falls back to compact JSON.
+	TranscriptRender func(interface{}) string
+
+	mu       sync.Mutex
+	nextID   int64
+	pending  map[int64]*pendingCall
+	handlers map[string]HandlerFunc
+	closed   chan struct{}
+}
+
+func newSession(transport Transport) *session {
+	s := &session{
+		transport: transport,
+		pending:   make(map[int64]*pendingCall),
+		handlers:  make(map[string]HandlerFunc),
+		closed:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Call sends a request and blocks until its matching "<"/"x" response
+// arrives, ctx is canceled, or the session closes. Canceling ctx drops the
+// pending entry so a late response is discarded instead of leaking.
+func (s *session) Call(ctx context.Context, method string, params interface{}) (interface{}, error) {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	pc := &pendingCall{resultCh: make(chan interface{}, 1), errCh: make(chan error, 1)}
+	s.pending[id] = pc
+	s.mu.Unlock()
+
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      int(id),
+		"method":  method,
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+
+	if err := s.send(msg); err != nil {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case result := <-pc.resultCh:
+		return result, nil
+	case err := <-pc.errCh:
+		return nil, err
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, fmt.Errorf("session: closed while waiting for %q", method)
+	}
+}
+
+// Notify sends a fire-and-forget "!" message; it never waits for a reply.
+func (s *session) Notify(method string, params interface{}) error {
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	return s.send(msg)
+}
+
+// Handle registers fn as the responder for inbound requests and
+// notifications addressed to method, replacing any handler already
+// registered for it.
+func (s *session) Handle(method string, fn HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[method] = fn
+	s.mu.Unlock()
+}
+
+// Close stops delivering new messages and fails every call still waiting
+// on a response. It does not close the underlying Transport.
+func (s *session) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	pending := s.pending
+	s.pending = make(map[int64]*pendingCall)
+	close(s.closed)
+	s.mu.Unlock()
+
+	for _, pc := range pending {
+		pc.errCh <- fmt.Errorf("session: closed")
+	}
+}
+
+func (s *session) send(msg map[string]interface{}) error {
+	if s.Transcript != nil {
+		s.logTranscript(msg)
+	}
+	return s.transport.Encode(msg)
+}
+
+func (s *session) logTranscript(msg interface{}) {
+	if s.TranscriptRender != nil {
+		fmt.Fprintf(s.Transcript, "%s\n", s.TranscriptRender(msg))
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.Transcript, "%s\n", data)
+}
+
+func (s *session) readLoop() {
+	for {
+		msg, err := s.transport.Decode()
+		if err != nil {
+			s.failPending(err)
+			return
+		}
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		if s.Transcript != nil {
+			s.logTranscript(msg)
+		}
+		s.dispatch(msg)
+	}
+}
+
+func (s *session) failPending(err error) {
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	pending := s.pending
+	s.pending = make(map[int64]*pendingCall)
+	close(s.closed)
+	s.mu.Unlock()
+
+	for _, pc := range pending {
+		pc.errCh <- err
+	}
+}
+
+func (s *session) dispatch(raw interface{}) {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if errVal, hasError := m["error"]; hasError {
+		s.deliverError(m["id"], errVal)
+		return
+	}
+	if result, hasResult := m["result"]; hasResult {
+		s.deliverResult(m["id"], result)
+		return
+	}
+
+	method, _ := m["method"].(string)
+	if method == "" {
+		return
+	}
+
+	s.mu.Lock()
+	fn := s.handlers[method]
+	s.mu.Unlock()
+
+	id, hasID := m["id"]
+	if fn == nil {
+		if hasID {
+			s.sendError(id, -32601, fmt.Sprintf("method not found: %s", method))
+		}
+		return
+	}
+
+	go func() {
+		result, err := fn(context.Background(), m["params"])
+		if !hasID {
+			return
+		}
+		if err != nil {
+			s.sendError(id, -32000, err.Error())
+			return
+		}
+		s.send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+	}()
+}
+
+func (s *session) deliverResult(id interface{}, result interface{}) {
+	key, ok := toInt64(id)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	pc := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+	if pc != nil {
+		pc.resultCh <- result
+	}
+}
+
+func (s *session) deliverError(id interface{}, errVal interface{}) {
+	key, ok := toInt64(id)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	pc := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+	if pc == nil {
+		return
+	}
+	pc.errCh <- errorFromValue(errVal)
+}
+
+func (s *session) sendError(id interface{}, code int, message string) {
+	s.send(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// errorFromValue renders a JSON-RPC "error" object (or any other shape a
+// Transport might hand back) as a Go error.
+func errorFromValue(errVal interface{}) error {
+	m, ok := errVal.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("session: %v", errVal)
+	}
+	message, _ := m["message"].(string)
+	if code, ok := toInt64(m["code"]); ok {
+		return fmt.Errorf("session: %s (code %d)", message, code)
+	}
+	return fmt.Errorf("session: %s", message)
+}
+
+// toInt64 accepts the numeric types a JSON-RPC "id"/"code" field can show
+// up as once it has round-tripped through different decoders: the native
+// int MCPDSLCompiler.Compile produces, or float64/json.Number from a
+// generic encoding/json decode.
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeTransport is an in-memory Transport backed by a channel, standing in
+// for a real DSL-backed Transport in tests.
+type pipeTransport struct {
+	out chan<- interface{}
+	in  <-chan interface{}
+}
+
+func (t pipeTransport) Encode(msg interface{}) error {
+	t.out <- msg
+	return nil
+}
+
+func (t pipeTransport) Decode() (interface{}, error) {
+	msg, ok := <-t.in
+	if !ok {
+		return nil, errors.New("pipe closed")
+	}
+	return msg, nil
+}
+
+// newPipe returns two Transports wired to each other, like a pair of
+// connected sockets.
+func newPipe() (Transport, Transport) {
+	ab := make(chan interface{}, 16)
+	ba := make(chan interface{}, 16)
+	return pipeTransport{out: ab, in: ba}, pipeTransport{out: ba, in: ab}
+}
+
+func TestClientCallReceivesServerResult(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	server := NewServer(serverTransport)
+
+	server.Handle("ping", func(ctx context.Context, params interface{}) (interface{}, error) {
+		return "pong", nil
+	})
+
+	result, err := client.Call(context.Background(), "ping", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != "pong" {
+		t.Errorf("expected %q, got %v", "pong", result)
+	}
+}
+
+func TestClientCallReceivesServerError(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	server := NewServer(serverTransport)
+
+	server.Handle("boom", func(ctx context.Context, params interface{}) (interface{}, error) {
+		return nil, errors.New("kaboom")
+	})
+
+	_, err := client.Call(context.Background(), "boom", nil)
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestServerNotifyRoutesToClientHandler(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	server := NewServer(serverTransport)
+
+	received := make(chan interface{}, 1)
+	client.Handle("progress", func(ctx context.Context, params interface{}) (interface{}, error) {
+		received <- params
+		return nil, nil
+	})
+
+	if err := server.Notify("progress", map[string]interface{}{"pct": 50}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case params := <-received:
+		m, ok := params.(map[string]interface{})
+		if !ok || m["pct"] != 50 {
+			t.Errorf("unexpected params: %v", params)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+}
+
+func TestCallHonorsContextCancellation(t *testing.T) {
+	clientTransport, _ := newPipe()
+	client := NewClient(clientTransport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.Call(ctx, "never-answered", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if len(client.pending) != 0 {
+		t.Errorf("expected pending call to be dropped, got %d entries", len(client.pending))
+	}
+}
+
+func TestTranscriptFallsBackToJSONWithoutRenderer(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	server := NewServer(serverTransport)
+
+	var buf strings.Builder
+	client.Transcript = &buf
+
+	server.Handle("ping", func(ctx context.Context, params interface{}) (interface{}, error) {
+		return "pong", nil
+	})
+	if _, err := client.Call(context.Background(), "ping", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), `"method":"ping"`) {
+		t.Errorf("expected a compact JSON line in the transcript, got:\n%s", buf.String())
+	}
+}
+
+func TestTranscriptUsesCallerSuppliedRenderer(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	server := NewServer(serverTransport)
+
+	var buf strings.Builder
+	client.Transcript = &buf
+	client.TranscriptRender = func(msg interface{}) string {
+		m, _ := msg.(map[string]interface{})
+		return fmt.Sprintf("DSL> %v", m["method"])
+	}
+
+	server.Handle("ping", func(ctx context.Context, params interface{}) (interface{}, error) {
+		return "pong", nil
+	})
+	if _, err := client.Call(context.Background(), "ping", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "DSL> ping") {
+		t.Errorf("expected the custom renderer's output in the transcript, got:\n%s", buf.String())
+	}
+}
+
+func TestCallFailsWhenMethodNotFound(t *testing.T) {
+	clientTransport, serverTransport := newPipe()
+	client := NewClient(clientTransport)
+	NewServer(serverTransport)
+
+	_, err := client.Call(context.Background(), "missing", nil)
+	if err == nil {
+		t.Fatal("expected an error for an unhandled method")
+	}
+}
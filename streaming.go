@@ -0,0 +1,809 @@
+// MCP-DSL Parser & Compiler - streaming, incremental API
+//
+// ParseMCPDSL and MCPDSLLexer require the whole input up front, which is
+// fine for a one-shot file but wasteful for tailing a live MCP session
+// log. StreamingLexer and StreamingParser instead pull bytes from an
+// io.Reader on demand and parse one top-level message at a time.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// StreamingLexer tokenizes MCP-DSL input pulled from an io.Reader, buffering
+// only a small amount of lookahead rather than indexing into a fixed string.
+type StreamingLexer struct {
+	r      *bufio.Reader
+	line   int
+	column int
+	offset int
+}
+
+// NewStreamingLexer creates a StreamingLexer reading from r.
+func NewStreamingLexer(r io.Reader) *StreamingLexer {
+	return &StreamingLexer{r: bufio.NewReader(r), line: 1, column: 1}
+}
+
+// peekByte returns the next unread byte without consuming it.
+func (l *StreamingLexer) peekByte() (byte, error) {
+	b, err := l.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// peekByteAt returns the byte n positions ahead (0 is the next unread
+// byte) without consuming anything.
+func (l *StreamingLexer) peekByteAt(n int) (byte, error) {
+	b, err := l.r.Peek(n + 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[n], nil
+}
+
+// advance consumes and returns the next byte, tracking line/column.
+func (l *StreamingLexer) advance() (byte, error) {
+	b, err := l.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	l.offset++
+	if b == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return b, nil
+}
+
+// skipWhitespace consumes whitespace characters up to the next token.
+func (l *StreamingLexer) skipWhitespace() error {
+	for {
+		b, err := l.peekByte()
+		if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return nil
+		}
+		if _, err := l.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+// atTripleQuote reports whether a """ heredoc opener/closer starts at the
+// next unread byte.
+func (l *StreamingLexer) atTripleQuote() bool {
+	b0, err0 := l.peekByteAt(0)
+	b1, err1 := l.peekByteAt(1)
+	b2, err2 := l.peekByteAt(2)
+	return err0 == nil && err1 == nil && err2 == nil && b0 == '"' && b1 == '"' && b2 == '"'
+}
+
+// readString reads a string literal, having already confirmed the opening
+// '"': either a normal "..." literal with backslash escapes (see
+// unescapeDSLChar), or a """...""" heredoc taken verbatim up to the next
+// """, mirroring MCPDSLLexer.readString.
+func (l *StreamingLexer) readString() (*Token, error) {
+	startLine, startCol, startOffset := l.line, l.column, l.offset
+
+	if l.atTripleQuote() {
+		for i := 0; i < 3; i++ {
+			if _, err := l.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		var value strings.Builder
+		for !l.atTripleQuote() {
+			b, err := l.peekByte()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+			value.WriteByte(b)
+			if _, err := l.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		for i := 0; i < 3; i++ {
+			l.advance() // closing """, if any
+		}
+		return &Token{Type: TokenString, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.offset - startOffset}, nil
+	}
+
+	if _, err := l.advance(); err != nil { // opening quote
+		return nil, err
+	}
+
+	var value strings.Builder
+	for {
+		b, err := l.peekByte()
+		if err != nil {
+			// An unterminated string at EOF still yields what was read;
+			// the caller treats the missing closing quote as input ending
+			// mid-token, same as mid-block truncation.
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if b == '"' {
+			break
+		}
+		if b == '\\' {
+			if _, err := l.advance(); err != nil {
+				return nil, err
+			}
+			b, err = l.peekByte()
+			if err != nil {
+				break
+			}
+			value.WriteByte(unescapeDSLChar(b))
+			if _, err := l.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		value.WriteByte(b)
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	l.advance() // closing quote, if any
+	return &Token{Type: TokenString, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.offset - startOffset}, nil
+}
+
+// readNumber reads a number literal.
+func (l *StreamingLexer) readNumber() (*Token, error) {
+	startLine, startCol, startOffset := l.line, l.column, l.offset
+	var value strings.Builder
+
+	for {
+		b, err := l.peekByte()
+		if err != nil {
+			break
+		}
+		if !unicode.IsDigit(rune(b)) && b != '.' && b != '-' {
+			break
+		}
+		value.WriteByte(b)
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Token{Type: TokenNumber, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.offset - startOffset}, nil
+}
+
+// readIdentifier reads an identifier or keyword.
+func (l *StreamingLexer) readIdentifier() (*Token, error) {
+	startLine, startCol, startOffset := l.line, l.column, l.offset
+	var value strings.Builder
+
+	for {
+		b, err := l.peekByte()
+		if err != nil {
+			break
+		}
+		if unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || b == '_' || b == '/' || b == '!' {
+			value.WriteByte(b)
+			if _, err := l.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if b == ':' {
+			next, err := l.peekByteAt(1)
+			if err == nil && next == '/' {
+				value.WriteByte(b)
+				if _, err := l.advance(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		break
+	}
+
+	return &Token{Type: TokenIdentifier, Value: value.String(), Line: startLine, Column: startCol, Offset: startOffset, Len: l.offset - startOffset}, nil
+}
+
+// Next reads and returns the next token from the stream, or (nil,
+// io.EOF) once the input is exhausted.
+func (l *StreamingLexer) Next() (*Token, error) {
+	if err := l.skipWhitespace(); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	char, err := l.peekByte()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	switch {
+	case strings.ContainsRune("><!x#@?:=|&-", rune(char)):
+		line, col, off := l.line, l.column, l.offset
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+		return &Token{Type: TokenOperator, Value: string(char), Line: line, Column: col, Offset: off, Len: 1}, nil
+	case char == '"':
+		return l.readString()
+	case unicode.IsDigit(rune(char)):
+		return l.readNumber()
+	case char == '-':
+		next, err := l.peekByteAt(1)
+		if err == nil && unicode.IsDigit(rune(next)) {
+			return l.readNumber()
+		}
+		line, col, off := l.line, l.column, l.offset
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+		return &Token{Type: TokenOperator, Value: string(char), Line: line, Column: col, Offset: off, Len: 1}, nil
+	case unicode.IsLetter(rune(char)) || char == '_':
+		return l.readIdentifier()
+	case strings.ContainsRune("{}[](),", rune(char)):
+		line, col, off := l.line, l.column, l.offset
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+		return &Token{Type: TokenSymbol, Value: string(char), Line: line, Column: col, Offset: off, Len: 1}, nil
+	default:
+		// Skip unknown characters and keep looking for the next token.
+		if _, err := l.advance(); err != nil {
+			return nil, err
+		}
+		return l.Next()
+	}
+}
+
+// StreamingParser parses MCP-DSL input one top-level message at a time off
+// an io.Reader, instead of tokenizing and buffering the whole document up
+// front. This makes it suitable for tailing a live MCP session log.
+type StreamingParser struct {
+	parser *MCPDSLParser
+}
+
+// NewStreamingParser creates a StreamingParser reading from r.
+func NewStreamingParser(r io.Reader) *StreamingParser {
+	lexer := NewStreamingLexer(r)
+	return &StreamingParser{parser: NewMCPDSLParserFromSource(lexer)}
+}
+
+// Next reads and parses exactly one top-level message, returning (nil,
+// io.EOF) once the input is exhausted. A malformed message is recorded as a
+// Diagnostic (see Errors) and parsing resynchronizes at the next message
+// sigil rather than stopping the stream, mirroring MCPDSLParser.Parse — a
+// truncated message at true EOF is reported as a Diagnostic too, without
+// discarding any message already returned by an earlier Next call. A
+// genuine error from the underlying reader is returned as-is and is not
+// recoverable.
+func (sp *StreamingParser) Next() (*ASTNode, error) {
+	for {
+		if sp.parser.peek() == nil {
+			if sp.parser.fillErr != nil && sp.parser.fillErr != io.EOF {
+				return nil, sp.parser.fillErr
+			}
+			return nil, io.EOF
+		}
+
+		startPos := sp.parser.position
+		node := sp.parser.parseMessage()
+		if sp.parser.position == startPos {
+			sp.parser.consume()
+		}
+		if node != nil {
+			return node, nil
+		}
+		// parseMessage recorded a Diagnostic and resynchronized; keep
+		// pulling until the next real message or the stream ends.
+	}
+}
+
+// Errors returns every Diagnostic recorded so far.
+func (sp *StreamingParser) Errors() []Diagnostic {
+	return sp.parser.errors
+}
+
+// Emit compiles a single parsed message to its JSON-RPC form and writes it
+// to w as one line of JSON. Pairing Next/Emit (and DecompileMCPJSON for the
+// reverse direction) lets a proxy translate a live DSL/JSON-RPC stream
+// message by message instead of batching the whole transcript.
+func Emit(w io.Writer, node *ASTNode) error {
+	if node == nil || node.Kind == ASTType {
+		return nil
+	}
+
+	compiler := NewMCPDSLCompiler()
+	types := collectTypes([]*ASTNode{node})
+	compiled := compiler.compileNode(node, types, exprEnv{})
+
+	data, err := json.Marshal(compiled)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("\n"))
+	return err
+}
+
+// ParseStream parses MCP-DSL messages one at a time from r, calling emit
+// for each one as soon as it's parsed rather than collecting them into a
+// slice first. A malformed message is recorded internally (see
+// StreamingParser.Errors) and skipped rather than stopping the stream,
+// mirroring StreamingParser.Next. It never buffers more than one top-level
+// message worth of tokens at a time, making it suitable for batch DSL
+// files too large to tokenize up front. emit returning an error stops the
+// stream immediately and that error is returned as-is, as is any error
+// from the underlying reader.
+func ParseStream(r io.Reader, emit func(*ASTNode) error) error {
+	sp := NewStreamingParser(r)
+	for {
+		node, err := sp.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := emit(node); err != nil {
+			return err
+		}
+	}
+}
+
+// CompileStream reads MCP-DSL messages from r and writes each one's
+// compiled JSON-RPC form to w as a line of newline-delimited JSON (see
+// Emit), so the tool can run as a Unix-style filter between an MCP client
+// and server without ever materializing the whole input or output.
+func CompileStream(r io.Reader, w io.Writer) error {
+	return ParseStream(r, func(node *ASTNode) error {
+		return Emit(w, node)
+	})
+}
+
+// DecompileTo is DecompileMCPJSON's streaming counterpart for a
+// ListToolsResult/ListResourcesResult/ListPromptsResult-shaped JSON object
+// (e.g. a tools/list response's "result" field): it reads dec token by
+// token and, for each top-level "tools"/"resources"/"prompts" array,
+// decodes and renders one element at a time via the existing
+// decompileTool/decompileResource/decompilePrompt helpers instead of
+// unmarshaling the whole array into memory first. Peak memory is bounded
+// by the largest single item rather than the whole document, so a dump of
+// thousands of tools or resources can be piped through gzip.Writer or an
+// http.ResponseWriter without buffering. Any other top-level field is
+// decoded and discarded; decompiling a bare JSON-RPC envelope or a single
+// definition is what Decompile/DecompileWithOptions are for.
+func DecompileTo(w io.Writer, dec *json.Decoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	decompiler := NewMCPDSLDecompiler()
+
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return fmt.Errorf("expected a JSON object key, got %v", keyTok)
+		}
+
+		var render func(map[string]interface{}) string
+		switch key {
+		case "tools":
+			render = func(item map[string]interface{}) string {
+				name, _ := item["name"].(string)
+				return decompiler.decompileTool(item, name)
+			}
+		case "resources":
+			render = func(item map[string]interface{}) string {
+				name, _ := item["name"].(string)
+				return decompiler.decompileResource(item, name, DecompileOptions{})
+			}
+		case "prompts":
+			render = func(item map[string]interface{}) string {
+				name, _ := item["name"].(string)
+				return decompiler.decompilePrompt(item, name)
+			}
+		}
+
+		if render == nil {
+			var discard interface{}
+			if err := dec.Decode(&discard); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := streamDecompileArray(dec, bw, render); err != nil {
+			return err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// streamDecompileArray decodes dec's next JSON array one element at a time,
+// rendering each with render and writing it to w followed by a blank line,
+// flushing after every item so progress is visible to a caller wrapping w
+// in gzip.Writer or an http.ResponseWriter without the whole array ever
+// living in memory as a single Go slice.
+func streamDecompileArray(dec *json.Decoder, w *bufio.Writer, render func(map[string]interface{}) string) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var item map[string]interface{}
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		w.WriteString(render(item))
+		w.WriteString("\n\n")
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// expectDelim consumes dec's next token and confirms it's the given
+// delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok || delim != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// StreamDecodeError reports a transport-level failure reading the next
+// message off a StreamDecoder — an underlying read error or a deadline
+// exceeded mid-read — with enough location info for structured
+// diagnostics: the absolute byte offset into the stream consumed so far,
+// and the lexer's current 1-based line/column. A malformed-but-recoverable
+// statement is not reported this way; that's a Diagnostic (see
+// StreamDecoder.Errors), mirroring StreamingParser.Next.
+type StreamDecodeError struct {
+	Offset int
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *StreamDecodeError) Error() string {
+	return fmt.Sprintf("mcp-dsl: stream decode error at offset %d (line %d, column %d): %v", e.Offset, e.Line, e.Column, e.Err)
+}
+
+func (e *StreamDecodeError) Unwrap() error { return e.Err }
+
+// countingReader tracks the number of bytes read so far, giving
+// StreamDecodeError a byte offset without needing every lexer in the
+// package to carry one.
+type countingReader struct {
+	r     io.Reader
+	count int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.count += n
+	return n, err
+}
+
+// deadlineReader wraps an io.Reader with an optional deadline, racing each
+// Read against a timer in its own goroutine — the same cancel-channel +
+// time.AfterFunc shape netstack's gonet adapter uses to give a plain
+// io.Reader/io.Writer pair Conn-like deadline semantics. A Read reads into
+// a private buffer rather than the caller's p, so an abandoned goroutine
+// (the timer fired first) can't race with the caller reusing p afterward.
+// Unlike a plain discard-and-retry, the goroutine isn't abandoned: pending
+// keeps it alive across the timeout, so the next Read waits on the same
+// goroutine instead of spawning a second one racing the same underlying
+// Reader, and leftover holds any bytes that goroutine produced but didn't
+// fit in the Read call that finally collected them. Together these make a
+// read deadline recoverable the way net.Conn's is — a timeout costs you a
+// Read call, not any stream bytes.
+type deadlineReader struct {
+	r        io.Reader
+	mu       sync.Mutex
+	deadline time.Time
+	pending  chan deadlineReadResult // non-nil: a prior timed-out Read's goroutine is still running
+	leftover []byte                  // bytes collected from pending that didn't fit the Read call that collected them
+	leftErr  error                   // the error that came with leftover, delivered once leftover drains
+}
+
+type deadlineReadResult struct {
+	buf []byte
+	err error
+}
+
+// SetDeadline arms (with a non-zero Time) or disarms (with the zero Time)
+// the deadline applied to every subsequent Read.
+func (dr *deadlineReader) SetDeadline(t time.Time) {
+	dr.mu.Lock()
+	dr.deadline = t
+	dr.mu.Unlock()
+}
+
+func (dr *deadlineReader) Read(p []byte) (int, error) {
+	dr.mu.Lock()
+	if len(dr.leftover) > 0 {
+		n := copy(p, dr.leftover)
+		dr.leftover = dr.leftover[n:]
+		var err error
+		if len(dr.leftover) == 0 {
+			err = dr.leftErr
+			dr.leftErr = nil
+		}
+		dr.mu.Unlock()
+		return n, err
+	}
+	deadline := dr.deadline
+	pending := dr.pending
+	dr.mu.Unlock()
+
+	// No deadline armed and no goroutine already in flight from an earlier
+	// timeout: read directly into p, same as before this type raced every
+	// Read against a timer goroutine. This keeps the common case (deadlines
+	// are opt-in) free of the allocation/goroutine/copy overhead the
+	// deadline-handling path below needs.
+	if deadline.IsZero() && pending == nil {
+		return dr.r.Read(p)
+	}
+
+	if pending == nil {
+		pending = make(chan deadlineReadResult, 1)
+		buf := make([]byte, len(p))
+		go func() {
+			n, err := dr.r.Read(buf)
+			pending <- deadlineReadResult{buf[:n], err}
+		}()
+		dr.mu.Lock()
+		dr.pending = pending
+		dr.mu.Unlock()
+	}
+
+	if deadline.IsZero() {
+		res := <-pending
+		dr.clearPending()
+		return dr.deliver(p, res)
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case res := <-pending:
+		dr.clearPending()
+		return dr.deliver(p, res)
+	case <-timer.C:
+		// Leave pending set: it's still the same in-flight goroutine, and
+		// the next Read (whether or not it arms a new deadline) waits on
+		// it instead of starting a second Read racing the same r.
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (dr *deadlineReader) clearPending() {
+	dr.mu.Lock()
+	dr.pending = nil
+	dr.mu.Unlock()
+}
+
+// deliver copies a completed pending Read's result into p, stashing
+// whatever doesn't fit (and the error that came with it) as leftover for
+// the next Read rather than discarding it.
+func (dr *deadlineReader) deliver(p []byte, res deadlineReadResult) (int, error) {
+	n := copy(p, res.buf)
+	if n < len(res.buf) {
+		dr.mu.Lock()
+		dr.leftover = res.buf[n:]
+		dr.leftErr = res.err
+		dr.mu.Unlock()
+		return n, nil
+	}
+	return n, res.err
+}
+
+// deadlineWriter is deadlineReader's write-side counterpart.
+type deadlineWriter struct {
+	w        io.Writer
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// SetDeadline arms (with a non-zero Time) or disarms (with the zero Time)
+// the deadline applied to every subsequent Write.
+func (dw *deadlineWriter) SetDeadline(t time.Time) {
+	dw.mu.Lock()
+	dw.deadline = t
+	dw.mu.Unlock()
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	dw.mu.Lock()
+	deadline := dw.deadline
+	dw.mu.Unlock()
+
+	if deadline.IsZero() {
+		return dw.w.Write(p)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	buf := append([]byte(nil), p...)
+	done := make(chan result, 1)
+	go func() {
+		n, err := dw.w.Write(buf)
+		done <- result{n, err}
+	}()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.n, res.err
+	case <-timer.C:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// StreamDecoder parses MCP-DSL messages one at a time off a persistent
+// io.Reader (stdio, a TCP/Unix socket, ...), compiling each complete
+// statement straight to its JSON-RPC form. It's a thin compiling wrapper
+// around StreamingParser — which already tracks brace balance across reads
+// and never buffers more than one message's tokens at once — giving
+// MCP-DSL the same incremental "read one message, get one message" framing
+// a long-lived stdio JSON-RPC transport expects, instead of ParseMCPDSL's
+// whole-buffer entry point.
+type StreamDecoder struct {
+	parser *StreamingParser
+	lexer  *StreamingLexer
+	reader *countingReader
+	rd     *deadlineReader
+}
+
+// NewStreamDecoder creates a StreamDecoder reading from r.
+func NewStreamDecoder(r io.Reader) *StreamDecoder {
+	rd := &deadlineReader{r: r}
+	reader := &countingReader{r: rd}
+	lexer := NewStreamingLexer(reader)
+	return &StreamDecoder{
+		parser: &StreamingParser{parser: NewMCPDSLParserFromSource(lexer)},
+		lexer:  lexer,
+		reader: reader,
+		rd:     rd,
+	}
+}
+
+// SetReadDeadline arms (or, with a zero Time, disarms) a deadline on every
+// subsequent Next call's underlying reads, so a slow or stalled producer of
+// DSL text can't wedge a server goroutine reading from it indefinitely.
+// Although the underlying deadlineReader itself recovers from a timeout
+// without losing bytes, a Next call that times out is still terminal for
+// this StreamDecoder: MCPDSLParser.fillErr latches the first read error a
+// parser sees, by design, so every later Next call returns that same
+// cached error rather than trying to read again. Recovering from a
+// timeout means constructing a new StreamDecoder around the same r.
+func (d *StreamDecoder) SetReadDeadline(t time.Time) {
+	d.rd.SetDeadline(t)
+}
+
+// Next parses and compiles the next complete DSL statement, returning
+// (nil, io.EOF) once the stream is exhausted. A malformed statement that
+// StreamingParser could resynchronize past is not an error here either —
+// it's recorded as a Diagnostic (see Errors) and skipped, mirroring
+// StreamingParser.Next. A Type declaration is parsed (so later statements
+// can still resolve "&Name" refs against it) but produces no message of
+// its own, so Next skips past it the same way Emit does for a one-shot
+// ParseStream. Only a genuine read failure or a deadline exceeded mid-read
+// is returned as an error, wrapped in a *StreamDecodeError with the
+// offending position.
+func (d *StreamDecoder) Next() (interface{}, error) {
+	for {
+		node, err := d.parser.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, &StreamDecodeError{
+				Offset: d.reader.count,
+				Line:   d.lexer.line,
+				Column: d.lexer.column,
+				Err:    err,
+			}
+		}
+		if node == nil || node.Kind == ASTType {
+			continue
+		}
+
+		compiler := NewMCPDSLCompiler()
+		types := collectTypes([]*ASTNode{node})
+		return compiler.compileNode(node, types, exprEnv{}), nil
+	}
+}
+
+// Errors returns every Diagnostic recorded so far for a statement
+// StreamingParser resynchronized past rather than treating as fatal.
+func (d *StreamDecoder) Errors() []Diagnostic {
+	return d.parser.Errors()
+}
+
+// StreamEncoder writes MCP-DSL messages one at a time to a persistent
+// io.Writer, decompiling each outbound JSON-RPC message to DSL text via
+// DecompileMCPJSON — StreamDecoder's write-side counterpart, so a
+// client/server pair can speak MCP-DSL as wire framing in both directions.
+type StreamEncoder struct {
+	w *deadlineWriter
+}
+
+// NewStreamEncoder creates a StreamEncoder writing to w.
+func NewStreamEncoder(w io.Writer) *StreamEncoder {
+	return &StreamEncoder{w: &deadlineWriter{w: w}}
+}
+
+// SetWriteDeadline arms (or, with a zero Time, disarms) a deadline on every
+// subsequent Encode call's underlying write.
+func (e *StreamEncoder) SetWriteDeadline(t time.Time) {
+	e.w.SetDeadline(t)
+}
+
+// Encode decompiles msg — a JSON-RPC message, typically one returned by
+// StreamDecoder.Next or built directly as a map[string]interface{} — to
+// DSL text and writes it followed by a newline, so the peer's
+// StreamDecoder sees one complete statement.
+func (e *StreamEncoder) Encode(msg interface{}) error {
+	dsl := DecompileMCPJSON(msg)
+	if dsl == "" {
+		return fmt.Errorf("mcp-dsl: unable to decompile message %#v to DSL", msg)
+	}
+	if _, err := io.WriteString(e.w, dsl); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamingParserMultipleMessages(t *testing.T) {
+	input := `> initialize#1 {v: "2025-06-18"}
+< #1 {v: "2025-06-18"}
+! initialized
+> tools/list#2
+`
+	sp := NewStreamingParser(strings.NewReader(input))
+
+	var kinds []ASTNodeKind
+	for {
+		node, err := sp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		kinds = append(kinds, node.Kind)
+	}
+
+	want := []ASTNodeKind{ASTRequest, ASTResponse, ASTNotification, ASTRequest}
+	if len(kinds) != len(want) {
+		t.Fatalf("expected %d messages, got %d: %v", len(want), len(kinds), kinds)
+	}
+	for i, k := range want {
+		if kinds[i] != k {
+			t.Errorf("message %d: expected kind %v, got %v", i, k, kinds[i])
+		}
+	}
+
+	if len(sp.Errors()) != 0 {
+		t.Errorf("expected no parse errors, got %v", sp.Errors())
+	}
+}
+
+func TestStreamingParserRecoversFromMalformedMessage(t *testing.T) {
+	input := `> ping#1
+@@@
+! initialized`
+
+	sp := NewStreamingParser(strings.NewReader(input))
+
+	var got []*ASTNode
+	for {
+		node, err := sp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, node)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 valid messages around the malformed one, got %d", len(got))
+	}
+	if got[0].Kind != ASTRequest || got[1].Kind != ASTNotification {
+		t.Errorf("expected request then notification, got %v then %v", got[0].Kind, got[1].Kind)
+	}
+	if len(sp.Errors()) != 1 {
+		t.Errorf("expected 1 parse error for the malformed line, got %v", sp.Errors())
+	}
+}
+
+func TestStreamingParserReportsTruncatedBlockAtEOF(t *testing.T) {
+	input := `> ping#1
+> initialize#2 {v: "2025-06-18"`
+
+	sp := NewStreamingParser(strings.NewReader(input))
+
+	first, err := sp.Next()
+	if err != nil || first == nil || first.Kind != ASTRequest {
+		t.Fatalf("expected first message to parse cleanly, got %v / %v", first, err)
+	}
+
+	second, err := sp.Next()
+	if err != nil {
+		t.Fatalf("expected the truncated message to be reported as a ParseError, not returned as err: %v", err)
+	}
+	if second == nil || second.Kind != ASTRequest {
+		t.Fatalf("expected the best-effort partial message to still be returned, got %v", second)
+	}
+
+	if _, err := sp.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the truncated message, got %v", err)
+	}
+
+	if len(sp.Errors()) != 1 {
+		t.Fatalf("expected 1 parse error for the unterminated block, got %v", sp.Errors())
+	}
+}
+
+func TestEmitWritesCompiledJSONLine(t *testing.T) {
+	result := ParseMCPDSL(`> ping#7`)
+	_ = result // sanity: the non-streaming path agrees with Emit below
+
+	sp := NewStreamingParser(strings.NewReader(`> ping#7`))
+	node, err := sp.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := Emit(&out, node); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+
+	got := strings.TrimSpace(out.String())
+	want := `{"id":7,"jsonrpc":"2.0","method":"ping"}`
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestEmitSkipsTypeDeclarations(t *testing.T) {
+	sp := NewStreamingParser(strings.NewReader(`Type Address { street: str! }`))
+	node, err := sp.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if node.Kind != ASTType {
+		t.Fatalf("expected an ASTType node, got %v", node.Kind)
+	}
+
+	var out bytes.Buffer
+	if err := Emit(&out, node); err != nil {
+		t.Fatalf("Emit failed: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected Emit to write nothing for a Type declaration, got %q", out.String())
+	}
+}
+
+func TestParseStreamEmitsEachMessage(t *testing.T) {
+	input := `> ping#1
+! initialized
+> tools/list#2
+`
+	var kinds []ASTNodeKind
+	err := ParseStream(strings.NewReader(input), func(node *ASTNode) error {
+		kinds = append(kinds, node.Kind)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []ASTNodeKind{ASTRequest, ASTNotification, ASTRequest}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("expected %v, got %v", want, kinds)
+	}
+}
+
+func TestParseStreamStopsOnEmitError(t *testing.T) {
+	input := `> ping#1
+! initialized`
+
+	boom := errors.New("boom")
+	count := 0
+	err := ParseStream(strings.NewReader(input), func(node *ASTNode) error {
+		count++
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("expected emit's error to propagate as-is, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected emit to stop the stream after its first error, got %d calls", count)
+	}
+}
+
+func TestCompileStreamWritesNDJSON(t *testing.T) {
+	input := `> ping#1
+! initialized`
+
+	var out bytes.Buffer
+	if err := CompileStream(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		`{"id":1,"jsonrpc":"2.0","method":"ping"}`,
+		`{"jsonrpc":"2.0","method":"initialized"}`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected %v, got %v", want, lines)
+	}
+}
+
+func TestStreamingLexerMatchesBatchLexer(t *testing.T) {
+	dsl := `> tools/call#3 {name: "search", args: {q: "MCP protocol"}}`
+
+	batch := NewMCPDSLLexer(dsl).Tokenize()
+
+	streaming := NewStreamingLexer(strings.NewReader(dsl))
+	var got []Token
+	for {
+		tok, err := streaming.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, *tok)
+	}
+
+	if len(got) != len(batch) {
+		t.Fatalf("expected %d tokens, got %d", len(batch), len(got))
+	}
+	for i := range batch {
+		if got[i].Type != batch[i].Type || got[i].Value != batch[i].Value {
+			t.Errorf("token %d: expected %+v, got %+v", i, batch[i], got[i])
+		}
+	}
+}
+
+func TestDecompileToStreamsToolsResourcesAndPrompts(t *testing.T) {
+	input := `{
+		"tools": [
+			{"name": "search", "description": "Search the web", "inputSchema": {"type": "object", "properties": {}}},
+			{"name": "fetch", "inputSchema": {"type": "object", "properties": {}}}
+		],
+		"resources": [
+			{"name": "doc", "uri": "file:///doc.txt"}
+		],
+		"nextCursor": "abc123",
+		"prompts": [
+			{"name": "greet", "messages": [{"role": "user", "content": "hi"}]}
+		]
+	}`
+
+	var out bytes.Buffer
+	if err := DecompileTo(&out, json.NewDecoder(strings.NewReader(input))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		`T search {`,
+		`T fetch {`,
+		`R doc {`,
+		`P greet {`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	if strings.Index(got, "T search") > strings.Index(got, "T fetch") {
+		t.Errorf("expected tools to stream in array order, got:\n%s", got)
+	}
+	if strings.Index(got, "T fetch") > strings.Index(got, "R doc") {
+		t.Errorf("expected resources after tools in document order, got:\n%s", got)
+	}
+	if strings.Index(got, "R doc") > strings.Index(got, "P greet") {
+		t.Errorf("expected prompts after resources, got:\n%s", got)
+	}
+}
+
+func TestDecompileToSkipsUnknownTopLevelFields(t *testing.T) {
+	input := `{"nextCursor": "abc", "tools": [{"name": "ping", "inputSchema": {"type": "object", "properties": {}}}]}`
+
+	var out bytes.Buffer
+	if err := DecompileTo(&out, json.NewDecoder(strings.NewReader(input))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(out.String(), `T ping {`) {
+		t.Errorf("expected the tool to still decompile despite an unknown sibling field, got:\n%s", out.String())
+	}
+}
+
+func TestDecompileToEmptyArrays(t *testing.T) {
+	input := `{"tools": [], "resources": []}`
+
+	var out bytes.Buffer
+	if err := DecompileTo(&out, json.NewDecoder(strings.NewReader(input))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output for empty arrays, got %q", out.String())
+	}
+}
+
+func TestStreamDecoderMultipleMessages(t *testing.T) {
+	input := `> initialize#1 {v: "2025-06-18"}
+< #1 {v: "2025-06-18"}
+! initialized
+> tools/list#2
+`
+	dec := NewStreamDecoder(strings.NewReader(input))
+
+	var got []interface{}
+	for {
+		msg, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, msg)
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %#v", len(got), got)
+	}
+	first, ok := got[0].(map[string]interface{})
+	if !ok || first["method"] != "initialize" {
+		t.Errorf("expected first message to be the initialize request, got %#v", got[0])
+	}
+	if len(dec.Errors()) != 0 {
+		t.Errorf("expected no parse errors, got %v", dec.Errors())
+	}
+}
+
+func TestStreamDecoderSkipsTypeDeclarations(t *testing.T) {
+	input := `Type Address { street: str! }
+> ping#1
+`
+	dec := NewStreamDecoder(strings.NewReader(input))
+
+	msg, err := dec.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, ok := msg.(map[string]interface{})
+	if !ok || m["method"] != "ping" {
+		t.Fatalf("expected the Type declaration to be skipped and ping returned first, got %#v", msg)
+	}
+
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the only message, got %v", err)
+	}
+}
+
+func TestStreamEncoderWritesDSLStatements(t *testing.T) {
+	var out bytes.Buffer
+	enc := NewStreamEncoder(&out)
+
+	if err := enc.Encode(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      float64(7),
+		"method":  "ping",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dec := NewStreamDecoder(&out)
+	msg, err := dec.Next()
+	if err != nil {
+		t.Fatalf("unexpected error decoding the encoded message: %v", err)
+	}
+	m, ok := msg.(map[string]interface{})
+	if !ok || m["method"] != "ping" {
+		t.Fatalf("expected the encoded ping to decode back, got %#v", msg)
+	}
+}
+
+func TestStreamDecoderReadDeadlineExceeded(t *testing.T) {
+	dec := NewStreamDecoder(&blockingReader{})
+	dec.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+
+	_, err := dec.Next()
+	var decodeErr *StreamDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a *StreamDecodeError, got %v (%T)", err, err)
+	}
+	if !errors.Is(decodeErr, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the error to wrap os.ErrDeadlineExceeded, got %v", decodeErr.Err)
+	}
+}
+
+// blockingReader never returns, simulating a stalled producer so
+// StreamDecoder's deadline is what unblocks Next instead of the read
+// itself completing.
+type blockingReader struct{}
+
+func (blockingReader) Read(p []byte) (int, error) {
+	select {}
+}
+
+// TestDeadlineReaderRecoversBytesAfterTimeout checks that a deadlineReader
+// timeout doesn't cost the underlying reader any bytes or spawn a second
+// goroutine racing it: the Read that was still in flight when the deadline
+// fired is not abandoned, so once it unblocks, the next Read (with the
+// deadline cleared) returns its result instead of starting a fresh
+// underlying Read call.
+func TestDeadlineReaderRecoversBytesAfterTimeout(t *testing.T) {
+	gr := &gatedReader{release: make(chan struct{}), data: []byte("hello")}
+	dr := &deadlineReader{r: gr}
+
+	dr.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, len(gr.data))
+	if _, err := dr.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected a deadline-exceeded error, got %v", err)
+	}
+
+	close(gr.release)
+	dr.SetDeadline(time.Time{})
+
+	n, err := dr.Read(buf)
+	if err != nil {
+		t.Fatalf("expected the timed-out read's bytes to resurface, got error: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Fatalf("expected %q, got %q", "hello", buf[:n])
+	}
+	if calls := gr.callCount(); calls != 1 {
+		t.Errorf("expected the timed-out Read to be reused rather than a second one started, got %d underlying Read calls", calls)
+	}
+}
+
+// gatedReader blocks every Read until release is closed, then returns data,
+// simulating a producer that's merely slow rather than permanently stalled
+// (unlike blockingReader). calls is read only after the test has already
+// synchronized on release/deadlineReader's own locking, so it needs no
+// synchronization of its own.
+type gatedReader struct {
+	release chan struct{}
+	data    []byte
+	calls   int
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	g.calls++
+	<-g.release
+	return copy(p, g.data), nil
+}
+
+func (g *gatedReader) callCount() int { return g.calls }
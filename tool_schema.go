@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ToolSchemaError is returned by ToolSchema.Validate/Bind and
+// ToolRegistry.Call when incoming "tools/call" arguments don't satisfy a
+// tool's declared inputSchema. It carries the same code/message a "x"
+// response would (see compileError/decompileError) plus a "data" field
+// listing every missing or mistyped argument.
+type ToolSchemaError struct {
+	Code    int
+	Message string
+	Issues  []string
+}
+
+func (e *ToolSchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(e.Issues, "; "))
+}
+
+// AsJSONRPCError renders e as the "error" object a "x #N ..." response
+// carries.
+func (e *ToolSchemaError) AsJSONRPCError() map[string]interface{} {
+	return map[string]interface{}{
+		"code":    e.Code,
+		"message": e.Message,
+		"data":    e.Issues,
+	}
+}
+
+// toolFieldSchema is one property of a ToolSchema's inputSchema, reduced to
+// the bits Validate/Bind need.
+type toolFieldSchema struct {
+	name     string
+	jsonType string
+	required bool
+}
+
+// ToolSchema validates and binds "tools/call" arguments against a tool's
+// declared `in:` block, compiled by compileTool into a standard JSON
+// Schema inputSchema.
+type ToolSchema struct {
+	Name   string
+	fields []toolFieldSchema
+}
+
+// NewToolSchema builds a ToolSchema from a compiled tool definition — the
+// same map[string]interface{} ParseMCPDSL returns for a top-level
+// `T name { in: {...} }` definition, or one element of a "tools" array
+// decoded from a tools/list response.
+func NewToolSchema(tool map[string]interface{}) *ToolSchema {
+	name, _ := tool["name"].(string)
+	schema := &ToolSchema{Name: name}
+
+	inputSchema, ok := tool["inputSchema"]
+	if !ok {
+		return schema
+	}
+	properties, ok := fieldOf(inputSchema, "properties")
+	if !ok {
+		return schema
+	}
+
+	required := schemaRequiredSet(inputSchema)
+	for _, key := range objectKeys(properties) {
+		propSchema, _ := fieldOf(properties, key)
+		typeVal, _ := fieldOf(propSchema, "type")
+		jsonType, _ := typeVal.(string)
+		schema.fields = append(schema.fields, toolFieldSchema{
+			name:     key,
+			jsonType: jsonType,
+			required: required[key],
+		})
+	}
+	return schema
+}
+
+// Validate checks a decoded "tools/call" arguments value (typically a
+// map[string]interface{} from json.Unmarshal) against the schema's
+// required fields and declared types. It returns a *ToolSchemaError
+// listing every problem found, or nil if args satisfies the schema.
+func (s *ToolSchema) Validate(args interface{}) error {
+	values, _ := args.(map[string]interface{})
+
+	var issues []string
+	for _, f := range s.fields {
+		value, present := values[f.name]
+		if !present {
+			if f.required {
+				issues = append(issues, fmt.Sprintf("%s: missing required field", f.name))
+			}
+			continue
+		}
+		if !jsonTypeMatches(f.jsonType, value) {
+			issues = append(issues, fmt.Sprintf("%s: expected %s, got %T", f.name, f.jsonType, value))
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil
+	}
+	return &ToolSchemaError{Code: -32602, Message: "Invalid params", Issues: issues}
+}
+
+// jsonTypeMatches reports whether a decoded JSON value v matches the JSON
+// Schema primitive type name produced by compileTypeString/primitiveJSONTypes.
+func jsonTypeMatches(jsonType string, v interface{}) bool {
+	switch jsonType {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "integer":
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	default:
+		return true
+	}
+}
+
+// Bind validates argsJSON — the raw JSON bytes of a "tools/call" request's
+// "arguments" field — against the schema, then binds it field-by-field
+// into dst, a pointer to a struct. Fields are matched by a `json` tag or,
+// failing that, the field's name with its first letter lowercased (the
+// same convention the DSL's own field names use, e.g. "code"/"language").
+func (s *ToolSchema) Bind(argsJSON []byte, dst interface{}) error {
+	var values map[string]interface{}
+	if len(argsJSON) > 0 {
+		if err := json.Unmarshal(argsJSON, &values); err != nil {
+			return &ToolSchemaError{Code: -32602, Message: "Invalid params", Issues: []string{err.Error()}}
+		}
+	}
+	if err := s.Validate(values); err != nil {
+		return err
+	}
+	return bindStruct(dst, values)
+}
+
+// bindStruct copies values into dst's exported fields via reflection,
+// converting each decoded JSON value to the field's Go type.
+func bindStruct(dst interface{}, values map[string]interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ToolSchema.Bind: dst must be a pointer to a struct, got %T", dst)
+	}
+
+	elem := rv.Elem()
+	t := elem.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		value, present := values[fieldJSONName(field)]
+		if !present {
+			continue
+		}
+		if err := setReflectValue(elem.Field(i), value); err != nil {
+			return &ToolSchemaError{Code: -32602, Message: "Invalid params", Issues: []string{fmt.Sprintf("%s: %v", field.Name, err)}}
+		}
+	}
+	return nil
+}
+
+// fieldJSONName resolves the argument name a struct field binds to: its
+// `json` tag if one is set, otherwise its name with a lowercased first
+// letter.
+func fieldJSONName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
+
+// setReflectValue assigns a decoded JSON value to a single struct field,
+// converting numbers/slices as needed; field must be addressable and
+// settable (bindStruct only calls this for exported fields).
+func setReflectValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		field.SetString(s)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %T", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", value)
+		}
+		field.SetFloat(n)
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %T", value)
+		}
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setReflectValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %T", value)
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(field.Type()) {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		field.Set(rv)
+	}
+	return nil
+}
+
+// ToolHandlerFunc implements a DSL-defined tool's behavior. args is the
+// same decoded map[string]interface{} ToolSchema.Validate checked.
+type ToolHandlerFunc func(ctx context.Context, args interface{}) (interface{}, error)
+
+type registeredTool struct {
+	schema  *ToolSchema
+	handler ToolHandlerFunc
+}
+
+// ToolRegistry wires DSL-defined tools directly to Go functions, analogous
+// to how HTTP router libraries bind path parameters to handler arguments:
+// Call validates incoming "tools/call" arguments against the tool's
+// declared inputSchema before invoking its handler, so a handler never
+// sees a missing or mistyped field.
+type ToolRegistry struct {
+	mu    sync.Mutex
+	tools map[string]registeredTool
+}
+
+// NewToolRegistry returns an empty ToolRegistry.
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]registeredTool)}
+}
+
+// RegisterTool wires schema's declared tool name to handler, replacing any
+// handler already registered for it.
+func (r *ToolRegistry) RegisterTool(schema *ToolSchema, handler ToolHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[schema.Name] = registeredTool{schema: schema, handler: handler}
+}
+
+// Call validates argsJSON against the named tool's schema and, on success,
+// decodes it and invokes the registered handler. It returns a
+// *ToolSchemaError (JSON-RPC -32602 "Invalid params") if no tool is
+// registered under name or if validation fails.
+func (r *ToolRegistry) Call(ctx context.Context, name string, argsJSON []byte) (interface{}, error) {
+	r.mu.Lock()
+	tool, ok := r.tools[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, &ToolSchemaError{Code: -32602, Message: "Invalid params", Issues: []string{fmt.Sprintf("unknown tool: %s", name)}}
+	}
+
+	var args map[string]interface{}
+	if len(argsJSON) > 0 {
+		if err := json.Unmarshal(argsJSON, &args); err != nil {
+			return nil, &ToolSchemaError{Code: -32602, Message: "Invalid params", Issues: []string{err.Error()}}
+		}
+	}
+	if err := tool.schema.Validate(args); err != nil {
+		return nil, err
+	}
+	return tool.handler(ctx, args)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func analyzeCodeToolSchema(t *testing.T) *ToolSchema {
+	t.Helper()
+	dsl := `T analyze_code {
+		desc: "Analyzes code for issues"
+		in: {
+			code: str!
+			language: str!
+			maxIssues: int
+		}
+	}`
+	result := ParseMCPDSL(dsl)
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected map, got %T", result)
+	}
+	return NewToolSchema(m)
+}
+
+func TestToolSchemaValidateRequiredFields(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+
+	err := schema.Validate(map[string]interface{}{"code": "x"})
+	if err == nil {
+		t.Fatal("expected an error for a missing required field")
+	}
+	schemaErr, ok := err.(*ToolSchemaError)
+	if !ok {
+		t.Fatalf("expected *ToolSchemaError, got %T", err)
+	}
+	if schemaErr.Code != -32602 {
+		t.Errorf("expected code -32602, got %d", schemaErr.Code)
+	}
+	if len(schemaErr.Issues) != 1 {
+		t.Errorf("expected 1 issue, got %v", schemaErr.Issues)
+	}
+}
+
+func TestToolSchemaValidateRejectsWrongType(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+
+	err := schema.Validate(map[string]interface{}{
+		"code":      "x",
+		"language":  "go",
+		"maxIssues": "not-a-number",
+	})
+	if err == nil {
+		t.Fatal("expected an error for a mistyped field")
+	}
+}
+
+func TestToolSchemaValidateAcceptsValidArgs(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+
+	err := schema.Validate(map[string]interface{}{
+		"code":      "x",
+		"language":  "go",
+		"maxIssues": 5.0,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestToolSchemaBindPopulatesStruct(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+
+	type analyzeArgs struct {
+		Code      string `json:"code"`
+		Language  string `json:"language"`
+		MaxIssues int    `json:"maxIssues"`
+	}
+
+	argsJSON, err := json.Marshal(map[string]interface{}{
+		"code":      "package main",
+		"language":  "go",
+		"maxIssues": 10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var args analyzeArgs
+	if err := schema.Bind(argsJSON, &args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.Code != "package main" || args.Language != "go" || args.MaxIssues != 10 {
+		t.Errorf("unexpected bound struct: %+v", args)
+	}
+}
+
+func TestToolSchemaBindRejectsInvalidArgs(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+
+	type analyzeArgs struct {
+		Code string `json:"code"`
+	}
+
+	argsJSON, _ := json.Marshal(map[string]interface{}{"code": "x"})
+
+	var args analyzeArgs
+	if err := schema.Bind(argsJSON, &args); err == nil {
+		t.Fatal("expected an error for missing required field language")
+	}
+}
+
+func TestToolRegistryCallInvokesHandler(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+	registry := NewToolRegistry()
+
+	var received interface{}
+	registry.RegisterTool(schema, func(ctx context.Context, args interface{}) (interface{}, error) {
+		received = args
+		return map[string]interface{}{"ok": true}, nil
+	})
+
+	argsJSON, _ := json.Marshal(map[string]interface{}{
+		"code":     "package main",
+		"language": "go",
+	})
+
+	result, err := registry.Call(context.Background(), "analyze_code", argsJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received == nil {
+		t.Fatal("expected handler to receive args")
+	}
+	resultMap, ok := result.(map[string]interface{})
+	if !ok || resultMap["ok"] != true {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
+
+func TestToolRegistryCallRejectsUnknownTool(t *testing.T) {
+	registry := NewToolRegistry()
+	_, err := registry.Call(context.Background(), "missing", nil)
+	if err == nil {
+		t.Fatal("expected an error for an unregistered tool")
+	}
+}
+
+func TestToolRegistryCallRejectsInvalidArgs(t *testing.T) {
+	schema := analyzeCodeToolSchema(t)
+	registry := NewToolRegistry()
+	registry.RegisterTool(schema, func(ctx context.Context, args interface{}) (interface{}, error) {
+		t.Fatal("handler should not run when validation fails")
+		return nil, nil
+	})
+
+	argsJSON, _ := json.Marshal(map[string]interface{}{"code": "x"})
+	_, err := registry.Call(context.Background(), "analyze_code", argsJSON)
+	if err == nil {
+		t.Fatal("expected an error for missing required field language")
+	}
+}